@@ -0,0 +1,102 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// Who or what makes a change, carried along the context
+const (
+	ActorAPI                = "api"
+	ActorRuleTimer          = "rule-timer"
+	ActorOverheatingControl = "overheating-control"
+	ActorSwitchControl      = "switch-control"
+	ActorRelayMonitor       = "relay-monitor"
+	ActorDeferredSwitch     = "deferred-switch"
+	ActorProfileScheduler   = "profile-scheduler"
+	ActorUnknown            = "unknown"
+
+	AUDIT_PAGE_SIZE = 50
+)
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+	return ActorUnknown
+}
+
+// Rules are kept in no particular order and the version changes every time,
+// don't report those as changes
+var auditDiffOptions = cmp.Options{
+	cmpopts.SortSlices(func(a, b *Rule) bool { return a.ID < b.ID }),
+	cmpopts.IgnoreFields(BoilerInfo{}, "Version"),
+	cmpopts.EquateEmpty(),
+}
+
+// Appends the change from before to after to the journal, nothing if they are the same
+func (c *Boiler) audit(ctx context.Context, kind AuditKind, before any, after any) error {
+	diff := cmp.Diff(before, after, auditDiffOptions)
+	if diff == "" {
+		return nil
+	}
+	now := time.Now()
+	entry := AuditEntry{
+		Time:   now,
+		Boiler: c.Config.Name,
+		Kind:   kind,
+		Actor:  ActorFrom(ctx),
+		Diff:   diff,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	err = c.client.JAppend(ctx, c.auditKey, now.UnixMilli(), data)
+	if err != nil {
+		return fmt.Errorf("could not record audit entry: %w", err)
+	}
+	return nil
+}
+
+// Most recent first. A nil kind matches every kind, a limit of 0 means AUDIT_PAGE_SIZE.
+func (c *Boiler) GetAuditLog(ctx context.Context, from time.Time, to time.Time, kind *AuditKind, offset int, limit int) (*AuditLogPage, error) {
+	if offset < 0 || limit < 0 {
+		return nil, fmt.Errorf("offset and limit cannot be negative")
+	}
+	if limit == 0 {
+		limit = AUDIT_PAGE_SIZE
+	}
+	journal, err := c.client.JRevRange(ctx, c.auditKey, from.UnixMilli(), to.UnixMilli(), 0)
+	if err != nil {
+		return nil, err
+	}
+	entries := []*AuditEntry{}
+	for _, item := range journal {
+		var entry AuditEntry
+		err := json.Unmarshal(item.Data, &entry)
+		if err != nil {
+			return nil, err
+		}
+		if kind == nil || entry.Kind == *kind {
+			entries = append(entries, &entry)
+		}
+	}
+	page := &AuditLogPage{Total: len(entries)}
+	start := min(offset, len(entries))
+	end := min(start+min(limit, math.MaxInt-start), len(entries))
+	page.Entries = entries[start:end]
+	return page, nil
+}
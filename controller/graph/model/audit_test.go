@@ -0,0 +1,117 @@
+package model_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/storage"
+	"stupid-caldaia/controller/testutils"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Now().Add(-time.Second)
+
+	apiCtx := model.WithActor(ctx, model.ActorAPI+":127.0.0.1")
+	_, err = boiler.Switch(apiCtx, model.StateOn, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing changes, nothing recorded
+	_, err = boiler.Switch(apiCtx, model.StateOn, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := boiler.SetRule(apiCtx, &model.Rule{Start: time.Now(), Duration: time.Hour, TargetTemp: testutils.MAX_TEMP - 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = boiler.StartRule(model.WithActor(ctx, model.ActorRuleTimer), rule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = boiler.SetOverheating(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := boiler.GetAuditLog(ctx, from, time.Now(), nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKinds := []model.AuditKind{model.AuditKindOverheating, model.AuditKindRule, model.AuditKindRule, model.AuditKindState}
+	wantActors := []string{model.ActorUnknown, model.ActorRuleTimer, model.ActorAPI + ":127.0.0.1", model.ActorAPI + ":127.0.0.1"}
+	if log.Total != len(wantKinds) || len(log.Entries) != len(wantKinds) {
+		t.Fatalf("Expected %d entries but got %d", len(wantKinds), log.Total)
+	}
+	for i, entry := range log.Entries {
+		if entry.Kind != wantKinds[i] || entry.Actor != wantActors[i] || entry.Boiler != boiler.Config.Name {
+			t.Fatalf("Entry %d: wanted %s by %s but got %s by %s", i, wantKinds[i], wantActors[i], entry.Kind, entry.Actor)
+		}
+	}
+	if !strings.Contains(log.Entries[3].Diff, string(model.StateOn)) {
+		t.Fatalf("Expected the switch diff to mention the new state but got %s", log.Entries[3].Diff)
+	}
+
+	// Filtered and paginated
+	kind := model.AuditKindRule
+	log, err = boiler.GetAuditLog(ctx, from, time.Now(), &kind, 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Total != 2 || len(log.Entries) != 1 || log.Entries[0].Actor != model.ActorAPI+":127.0.0.1" {
+		t.Fatalf("Expected the second of 2 rule changes but got %d of %d", len(log.Entries), log.Total)
+	}
+	log, err = boiler.GetAuditLog(ctx, from, time.Now(), nil, 10, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log.Entries) != 0 {
+		t.Fatalf("Expected an empty page past the end but got %d entries", len(log.Entries))
+	}
+}
+
+// The journal is down, everything else works
+type failingJournal struct {
+	storage.Storage
+}
+
+func (s failingJournal) JAppend(ctx context.Context, key string, timestamp int64, data []byte) error {
+	return errors.New("journal unavailable")
+}
+
+func TestAuditFailureKeepsChange(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unaudited, err := model.NewBoiler(ctx, failingJournal{testutils.CreateTestStorage()}, boiler.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := boiler.Listen(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = unaudited.Switch(ctx, model.StateOn, false)
+	if err != nil {
+		t.Fatalf("Expected the switch to succeed without the audit but got %v", err)
+	}
+	select {
+	case info := <-listener:
+		if info.State != model.StateOn {
+			t.Fatalf("Expected the new state to be published but got %s", info.State)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for the new state")
+	}
+}
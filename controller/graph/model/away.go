@@ -0,0 +1,112 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// The rule standing in for the suspended ones while away
+const AWAY_RULE_ID = "away"
+
+// From start (included) to end (excluded), nil means not away
+func (a *AwayMode) IsActive(now time.Time) bool {
+	return a != nil && !now.Before(a.Start) && now.Before(a.End)
+}
+
+// True once the away period is over and the rules should take back control
+func (a *AwayMode) IsOver(now time.Time) bool {
+	return a != nil && !now.Before(a.End)
+}
+
+// Holds the frost protection minimum for the whole away period
+func (a *AwayMode) Rule() *Rule {
+	return &Rule{
+		ID:         AWAY_RULE_ID,
+		Start:      a.Start,
+		Duration:   a.End.Sub(a.Start),
+		TargetTemp: a.FrostTemp,
+		IsActive:   true,
+		Kind:       RuleKindHeat,
+		RepeatDays: []int{},
+		Warnings:   []string{},
+	}
+}
+
+// Suspends the rules from start to end and holds frostTemp instead. Rules keep
+// their state and are back in control once end is reached.
+func (c *Boiler) SetAwayMode(ctx context.Context, start time.Time, end time.Time, frostTemp float64) (*BoilerInfo, error) {
+	if !end.After(start) {
+		return nil, fmt.Errorf("away mode must end after it starts")
+	}
+	if !end.After(time.Now()) {
+		return nil, fmt.Errorf("away mode must end in the future")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	info, err := c.update(ctx, AuditKindAway, func(info *BoilerInfo) error {
+		if frostTemp < 0 || frostTemp > info.MaxTemp {
+			return fmt.Errorf("frost protection temperature out of bounds")
+		}
+		info.Away = &AwayMode{Start: start, End: end, FrostTemp: frostTemp}
+		// The away rule takes control in what is published and returned
+		fillRuleStatus(info, time.Now(), c.location())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("🧳 Away from %s to %s, holding %.1f°C\n", start.Format(time.DateTime), end.Format(time.DateTime), frostTemp)
+	return info, nil
+}
+
+// Gives control back to the rules, whether the away period is over or not
+func (c *Boiler) CancelAwayMode(ctx context.Context) (*BoilerInfo, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	info, err := c.update(ctx, AuditKindAway, func(info *BoilerInfo) error {
+		info.Away = nil
+		fillRuleStatus(info, time.Now(), c.location())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("🏠 Back home, rules are in control again\n")
+	return info, nil
+}
+
+func (c *Boiler) ListenAway(ctx context.Context) (<-chan *AwayMode, error) {
+	awayUpdates := make(chan *AwayMode)
+	boilerInfo, err := c.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	currentAway := boilerInfo.Away
+	boilerListener, err := c.Listen(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer close(awayUpdates)
+		for {
+			select {
+			case boilerInfo = <-boilerListener:
+				newAway := boilerInfo.Away
+				if !cmp.Equal(currentAway, newAway) {
+					select {
+					case awayUpdates <- newAway:
+					case <-ctx.Done():
+						return
+					}
+				}
+				currentAway = newAway
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return awayUpdates, nil
+}
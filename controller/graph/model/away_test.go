@@ -0,0 +1,98 @@
+package model_test
+
+import (
+	"context"
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/testutils"
+	"testing"
+	"time"
+)
+
+func TestAwayModeIsActive(t *testing.T) {
+	now := time.Now()
+	away := &model.AwayMode{Start: now, End: now.Add(time.Hour), FrostTemp: 7}
+	testCases := []struct {
+		name       string
+		away       *model.AwayMode
+		at         time.Time
+		wantActive bool
+		wantOver   bool
+	}{
+		{"Not away", nil, now, false, false},
+		{"Before start", away, now.Add(-time.Second), false, false},
+		{"At start", away, now, true, false},
+		{"Before end", away, now.Add(time.Hour - time.Second), true, false},
+		{"At end", away, now.Add(time.Hour), false, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if active := tc.away.IsActive(tc.at); active != tc.wantActive {
+				t.Fatalf("Expected active %v but got %v", tc.wantActive, active)
+			}
+			if over := tc.away.IsOver(tc.at); over != tc.wantOver {
+				t.Fatalf("Expected over %v but got %v", tc.wantOver, over)
+			}
+		})
+	}
+}
+
+func TestAwayModeSuspendsRules(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rule, err := boiler.SetRule(ctx, &model.Rule{Start: now.Add(-time.Minute), Duration: time.Hour, TargetTemp: testutils.MAX_TEMP - 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = boiler.StartRule(ctx, rule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bad periods and temperatures are refused
+	if _, err := boiler.SetAwayMode(ctx, now, now.Add(-time.Hour), model.DEFAULT_FROST_TEMPERATURE); err == nil {
+		t.Fatal("Away mode shouldn't end before it starts")
+	}
+	if _, err := boiler.SetAwayMode(ctx, now.Add(-2*time.Hour), now.Add(-time.Hour), model.DEFAULT_FROST_TEMPERATURE); err == nil {
+		t.Fatal("Away mode shouldn't end in the past")
+	}
+	if _, err := boiler.SetAwayMode(ctx, now, now.Add(time.Hour), testutils.MAX_TEMP+1); err == nil {
+		t.Fatal("Frost protection temperature shouldn't be above the max temperature")
+	}
+
+	info, err := boiler.SetAwayMode(ctx, now.Add(-time.Minute), now.Add(24*time.Hour), boiler.FrostTemperature())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Away == nil || info.Away.FrostTemp != model.DEFAULT_FROST_TEMPERATURE {
+		t.Fatalf("Expected away mode holding the default frost temperature but got %v", info.Away)
+	}
+	if info.RuleInControl == nil || info.RuleInControl.ID != model.AWAY_RULE_ID {
+		t.Fatalf("Expected the away rule in control as soon as it is set but got %v", info.RuleInControl)
+	}
+	info, err = boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.RuleInControl == nil || info.RuleInControl.ID != model.AWAY_RULE_ID || info.RuleInControl.TargetTemp != model.DEFAULT_FROST_TEMPERATURE {
+		t.Fatalf("Expected the away rule in control but got %v", info.RuleInControl)
+	}
+	if len(info.Rules) != 1 || !info.Rules[0].IsActive {
+		t.Fatalf("Expected the rule to be kept as it was but got %v", info.Rules)
+	}
+
+	// Back home the rule is in control again
+	info, err = boiler.CancelAwayMode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Away != nil {
+		t.Fatalf("Expected no away mode but got %v", info.Away)
+	}
+	if info.RuleInControl == nil || info.RuleInControl.ID != rule.ID {
+		t.Fatalf("Expected the rule in control but got %v", info.RuleInControl)
+	}
+}
@@ -0,0 +1,121 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// The rule standing in for every other one while boosting
+const BOOST_RULE_ID = "boost"
+
+// Nil means no boost
+func (b *Boost) IsActive(now time.Time) bool {
+	return b != nil && !now.Before(b.Start) && now.Before(b.End)
+}
+
+// True once the boost has run its time and should be cleaned up
+func (b *Boost) IsOver(now time.Time) bool {
+	return b != nil && !now.Before(b.End)
+}
+
+func (b *Boost) Rule() *Rule {
+	return &Rule{
+		ID:         BOOST_RULE_ID,
+		Start:      b.Start,
+		Duration:   b.End.Sub(b.Start),
+		TargetTemp: b.TargetTemp,
+		IsActive:   true,
+		Kind:       RuleKindHeat,
+		RepeatDays: []int{},
+		Warnings:   []string{},
+	}
+}
+
+// Heats to targetTemp from now for the given minutes, whatever the rules and
+// away mode say. Replaces a running boost.
+func (c *Boiler) Boost(ctx context.Context, targetTemp float64, minutes float64) (*BoilerInfo, error) {
+	if minutes <= 0 {
+		return nil, fmt.Errorf("a boost must last some minutes")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	info, err := c.update(ctx, AuditKindBoost, func(info *BoilerInfo) error {
+		if targetTemp < info.MinTemp || targetTemp > info.MaxTemp {
+			return fmt.Errorf("target temperature out of bounds")
+		}
+		info.Boost = &Boost{
+			TargetTemp: targetTemp,
+			Start:      now,
+			End:        now.Add(time.Duration(minutes * float64(time.Minute))),
+		}
+		// The boost rule takes control in what is published and returned
+		fillRuleStatus(info, now, c.location())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("🚀 Boosting %s to %.1f°C until %s\n", c.Config.Name, targetTemp, info.Boost.End.Format(time.TimeOnly))
+	return info, nil
+}
+
+// Back to the rules, whether the boost is over or not
+func (c *Boiler) CancelBoost(ctx context.Context) (*BoilerInfo, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	info, err := c.update(ctx, AuditKindBoost, func(info *BoilerInfo) error {
+		info.Boost = nil
+		fillRuleStatus(info, time.Now(), c.location())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("🛬 Boost of %s is over\n", c.Config.Name)
+	return info, nil
+}
+
+func fillBoostStatus(info *BoilerInfo, now time.Time) {
+	if info.Boost != nil {
+		info.Boost.MinutesLeft = max(info.Boost.End.Sub(now).Minutes(), 0)
+	}
+}
+
+func (c *Boiler) ListenBoost(ctx context.Context) (<-chan *Boost, error) {
+	boostUpdates := make(chan *Boost)
+	boilerInfo, err := c.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	currentBoost := boilerInfo.Boost
+	boilerListener, err := c.Listen(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Only when it is set or cancelled, not as time goes by
+	sameBoost := func(a, b *Boost) bool {
+		return a == nil && b == nil || a != nil && b != nil && a.TargetTemp == b.TargetTemp && a.Start.Equal(b.Start) && a.End.Equal(b.End)
+	}
+	go func() {
+		defer close(boostUpdates)
+		for {
+			select {
+			case boilerInfo = <-boilerListener:
+				newBoost := boilerInfo.Boost
+				if !sameBoost(currentBoost, newBoost) {
+					select {
+					case boostUpdates <- newBoost:
+					case <-ctx.Done():
+						return
+					}
+				}
+				currentBoost = newBoost
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return boostUpdates, nil
+}
@@ -0,0 +1,79 @@
+package model_test
+
+import (
+	"context"
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/testutils"
+	"testing"
+	"time"
+)
+
+func TestBoostOverridesRulesAndAway(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rule, err := boiler.SetRule(ctx, &model.Rule{Start: now.Add(-time.Minute), Duration: time.Hour, TargetTemp: testutils.MIN_TEMP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = boiler.StartRule(ctx, rule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = boiler.SetAwayMode(ctx, now.Add(-time.Minute), now.Add(24*time.Hour), boiler.FrostTemperature())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bad durations and temperatures are refused
+	if _, err := boiler.Boost(ctx, testutils.MAX_TEMP, 0); err == nil {
+		t.Fatal("A boost shouldn't last no time")
+	}
+	if _, err := boiler.Boost(ctx, testutils.MAX_TEMP+1, 30); err == nil {
+		t.Fatal("A boost shouldn't go above the max temperature")
+	}
+
+	info, err := boiler.Boost(ctx, testutils.MAX_TEMP, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Boost == nil || info.Boost.TargetTemp != testutils.MAX_TEMP || info.Boost.MinutesLeft <= 29 || info.Boost.MinutesLeft > 30 {
+		t.Fatalf("Expected a 30 minutes boost but got %v", info.Boost)
+	}
+	if info.RuleInControl == nil || info.RuleInControl.ID != model.BOOST_RULE_ID {
+		t.Fatalf("Expected the boost rule in control as soon as it starts but got %v", info.RuleInControl)
+	}
+	info, err = boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.RuleInControl == nil || info.RuleInControl.ID != model.BOOST_RULE_ID || info.RuleInControl.TargetTemp != testutils.MAX_TEMP {
+		t.Fatalf("Expected the boost rule in control but got %v", info.RuleInControl)
+	}
+	if !info.Boost.IsOver(info.Boost.End) || info.Boost.IsActive(info.Boost.End) {
+		t.Fatalf("Expected the boost to be over at its end but got %v", info.Boost)
+	}
+
+	// Then away mode is back in control, and the rule after it
+	info, err = boiler.CancelBoost(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Boost != nil || info.RuleInControl == nil || info.RuleInControl.ID != model.AWAY_RULE_ID {
+		t.Fatalf("Expected away mode in control but got %v %v", info.Boost, info.RuleInControl)
+	}
+	_, err = boiler.CancelAwayMode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.RuleInControl == nil || info.RuleInControl.ID != rule.ID {
+		t.Fatalf("Expected the rule in control but got %v", info.RuleInControl)
+	}
+}
@@ -3,12 +3,15 @@ package model
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"sync"
 	"time"
 
+	"stupid-caldaia/controller/storage"
+
 	"github.com/google/go-cmp/cmp"
-	"github.com/redis/go-redis/v9"
 )
 
 type BoilerConfig struct {
@@ -16,21 +19,88 @@ type BoilerConfig struct {
 	DefaultMinTemperature float64
 	DefaultMaxTemperature float64
 	SwitchPin             int
+	Control               ControlConfig
+	Sensor                string // Id of the sensor driving the control, like "temperatura:centrale"
+	// Several sensors can drive the control together, Sensor is ignored then
+	Sensors []ControlSensor
+	Fusion  string // How Sensors are combined: "mean" (weighted, default), "min", "max" or "median"
+	// What to do when every control sensor is stale
+	Failsafe FailsafeConfig
+	// Anti short-cycling, zero values disable the limit
+	MinOnSeconds       float64 // Minimum time ON before switching OFF
+	MinOffSeconds      float64 // Minimum time OFF before switching ON
+	MaxSwitchesPerHour int     // Maximum ON/OFF transitions in the last hour
+	// Optimal start: heat ahead of a rule to reach its target when it starts
+	OptimalStart   bool
+	MaxLeadMinutes float64 // Never start heating earlier than this
+	// Home timezone rules repeat in, set from the store config. Nil is the local one.
+	Location *time.Location `json:"-"`
+	// Always heat below this, whatever the rules, and hold it while away.
+	// Zero falls back to DEFAULT_FROST_TEMPERATURE.
+	FrostTemperature float64
+	// Overheating protection defaults, zero values fall back to OH_* constants
+	Overheating OverheatingSettings
+	// Gas usage estimate in the heating statistics
+	Burner BurnerConfig
+	// Prices of the gas burnt, for the heating costs
+	Tariff TariffConfig
+	// Id of the outdoor sensor for the degree days, like "temperatura:esterno"
+	OutdoorSensor string
+	// Degree days are counted below this, zero falls back to DEFAULT_DEGREE_DAY_BASE
+	DegreeDayBase float64
+}
+
+type ControlSensor struct {
+	Id     string  // Like "temperatura:centrale"
+	Weight float64 // Only for the "mean" fusion, defaults to 1
+}
+
+// Without a trustworthy temperature the boiler is kept OFF, or heats for
+// DutyCycle of every cycle to protect the house from freezing
+type FailsafeConfig struct {
+	DutyCycle    float64 // Between 0 (always OFF, default) and 1
+	CycleMinutes float64 // Default 60 minutes
+}
+
+// Which strategy decides the On/Off state and its parameters. Zero values
+// fall back to the strategy defaults.
+type ControlConfig struct {
+	Strategy     string  // "threshold" (default), "hysteresis" or "pi"
+	LowerMargin  float64 // In °C, for "hysteresis" heating starts below target - LowerMargin
+	UpperMargin  float64 // In °C, for "hysteresis" heating stops above target + UpperMargin, rules can override both only with "hysteresis"
+	Kp           float64 // Duty cycle per °C, for "pi"
+	Ki           float64 // Duty cycle per °C per minute, for "pi"
+	CycleSeconds int     // Time-proportional cycle length, for "pi"
 }
 
 type Boiler struct {
 	Config              BoilerConfig
-	client              *redis.Client
+	client              storage.Storage
 	lock                sync.Mutex
+	publishLock         sync.Mutex // Guards stateUpdateCancel, state changes and heartbeats both publish
 	stateUpdateCancel   context.CancelFunc
 	switchSeriesKey     string
 	protectionSeriesKey string
+	warmUpKey           string
+	deferTimer          *time.Timer
+
+	overheatingSettingsKey    string
+	overheatingIndexSeriesKey string
+	auditKey                  string
+	frostKey                  string
+	ruleControlKey            string
 }
 
 const (
 	stateUpdateBatchingTime = 1000 // In microseconds
+	updateRetryBackoff      = 20 * time.Millisecond
+
+	MAX_UPDATE_ATTEMPTS = 5
 )
 
+// Somebody else kept changing the state while we tried to
+var ErrConflict = errors.New("the boiler state was changed concurrently")
+
 func GetStateIndex(state State) int {
 	for i, item := range AllState {
 		if item == state {
@@ -40,27 +110,46 @@ func GetStateIndex(state State) int {
 	return -1
 }
 
-func NewBoiler(ctx context.Context, client *redis.Client, config BoilerConfig) (*Boiler, error) {
+func NewBoiler(ctx context.Context, client storage.Storage, config BoilerConfig) (*Boiler, error) {
 	boiler := Boiler{
 		Config:              config,
 		client:              client,
 		switchSeriesKey:     "switch:" + config.Name,
 		protectionSeriesKey: "overheating:" + config.Name,
+		warmUpKey:           "warmup:" + config.Name,
+
+		overheatingSettingsKey:    "overheating-settings:" + config.Name,
+		overheatingIndexSeriesKey: "overheating-index:" + config.Name,
+		auditKey:                  "audit:" + config.Name,
+		frostKey:                  "frost-protection:" + config.Name,
+		ruleControlKey:            "rule-control:" + config.Name,
+	}
+	if err := boiler.defaultOverheatingSettings().Validate(); err != nil {
+		return &boiler, err
 	}
 	_, err := boiler.GetInfo(ctx)
 
 	// Check if switch state series already exists
-	exists, err := client.Exists(ctx, boiler.switchSeriesKey).Result()
-	if exists == 0 {
-		_, err := client.TSCreateWithArgs(ctx, boiler.switchSeriesKey, &redis.TSOptions{}).Result()
+	exists, err := client.Exists(ctx, boiler.switchSeriesKey)
+	if !exists {
+		err := client.TSCreate(ctx, boiler.switchSeriesKey, &storage.SeriesOptions{})
 		if err != nil {
 			return &boiler, err
 		}
 	}
 
-	exists, err = client.Exists(ctx, boiler.protectionSeriesKey).Result()
-	if exists == 0 {
-		_, err := client.TSCreateWithArgs(ctx, boiler.protectionSeriesKey, &redis.TSOptions{}).Result()
+	exists, err = client.Exists(ctx, boiler.protectionSeriesKey)
+	if !exists {
+		err := client.TSCreate(ctx, boiler.protectionSeriesKey, &storage.SeriesOptions{})
+		if err != nil {
+			return &boiler, err
+		}
+	}
+
+	// Recorded at every overheating check, keep only recent history
+	exists, err = client.Exists(ctx, boiler.overheatingIndexSeriesKey)
+	if !exists {
+		err := client.TSCreate(ctx, boiler.overheatingIndexSeriesKey, &storage.SeriesOptions{Retention: PrimaryRetentionTime})
 		if err != nil {
 			return &boiler, err
 		}
@@ -70,179 +159,252 @@ func NewBoiler(ctx context.Context, client *redis.Client, config BoilerConfig) (
 
 // Function to switch the relay on or off
 // Accepts only two values: "on" or "off"
-func (c *Boiler) Switch(ctx context.Context, targetState State) (*State, error) {
+//
+// When switching now would short-cycle the burner, the switch is deferred
+// until allowed and the returned state is the current one. A safety stop,
+// like the failsafe OFF, switches OFF right away whatever the cycling limits.
+func (c *Boiler) Switch(ctx context.Context, targetState State, safety bool) (*State, error) {
+	if targetState != StateOn && targetState != StateOff {
+		return &targetState, fmt.Errorf("invalid state to set")
+	}
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	info, err := c.GetInfo(ctx)
+	var allowedTime time.Time
+	info, err := c.update(ctx, AuditKindState, func(info *BoilerInfo) error {
+		var err error
+		allowedTime, err = c.nextAllowedSwitch(ctx, info, targetState, safety)
+		if err != nil {
+			return err
+		}
+		if allowedTime.After(time.Now()) {
+			info.DeferredState = &targetState
+			info.DeferredUntil = &allowedTime
+		} else {
+			info.State = targetState
+			info.DeferredState = nil
+			info.DeferredUntil = nil
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if targetState != StateOn && targetState != StateOff {
-		return &targetState, fmt.Errorf("invalid state to set")
+	if info.DeferredState != nil {
+		c.scheduleDeferredSwitch(targetState, allowedTime)
+	} else {
+		c.cancelDeferredSwitch()
+	}
+	return &info.State, nil
+}
+
+// Needs the lock to be held
+func (c *Boiler) scheduleDeferredSwitch(targetState State, allowedTime time.Time) {
+	c.cancelDeferredSwitch()
+	c.deferTimer = time.AfterFunc(time.Until(allowedTime), func() {
+		// The request that deferred this may be long gone, use our own context
+		ctx := WithActor(context.Background(), ActorDeferredSwitch)
+		info, err := c.GetInfo(ctx)
+		if err != nil {
+			fmt.Println(fmt.Errorf("could not apply deferred switch: %w", err))
+			return
+		}
+		if info.DeferredState == nil || *info.DeferredState != targetState {
+			return
+		}
+		fmt.Printf("⏳ Applying deferred switch to %s\n", targetState)
+		if _, err := c.Switch(ctx, targetState, false); err != nil {
+			fmt.Println(fmt.Errorf("could not apply deferred switch: %w", err))
+		}
+	})
+}
+
+// Needs the lock to be held
+func (c *Boiler) cancelDeferredSwitch() {
+	if c.deferTimer != nil {
+		c.deferTimer.Stop()
+		c.deferTimer = nil
 	}
-	info.State = targetState
-	err = c.save(ctx, info)
-	return &info.State, err
 }
 
 func (c *Boiler) SetOverheating(ctx context.Context, isOverheating bool) error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	info, err := c.GetInfo(ctx)
-	if err != nil {
-		return err
-	}
-	info.IsOverheatingProtectionActive = isOverheating
-	err = c.save(ctx, info)
+	_, err := c.update(ctx, AuditKindOverheating, func(info *BoilerInfo) error {
+		info.IsOverheatingProtectionActive = isOverheating
+		return nil
+	})
 	return err
 }
 
 func (c *Boiler) SetMinTemp(ctx context.Context, temp float64) (*float64, error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	info, err := c.GetInfo(ctx)
-	if err != nil {
+	info, err := c.update(ctx, AuditKindTemperatureLimits, func(info *BoilerInfo) error {
+		if temp < info.MinTemp || temp > info.MaxTemp {
+			return fmt.Errorf("invalid min temperature")
+		}
+		info.MinTemp = temp
+		return nil
+	})
+	if info == nil {
 		return nil, err
 	}
-	if temp < info.MinTemp || temp > info.MaxTemp {
-		return &info.MinTemp, fmt.Errorf("invalid min temperature")
-	}
-	info.MinTemp = temp
-	err = c.save(ctx, info)
 	return &info.MinTemp, err
 }
 
 func (c *Boiler) SetMaxTemp(ctx context.Context, temp float64) (*float64, error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	info, err := c.GetInfo(ctx)
-	if err != nil {
+	info, err := c.update(ctx, AuditKindTemperatureLimits, func(info *BoilerInfo) error {
+		if temp > info.MaxTemp || temp < info.MinTemp {
+			return fmt.Errorf("invalid max temperature")
+		}
+		info.MaxTemp = temp
+		return nil
+	})
+	if info == nil {
 		return nil, err
 	}
-	if temp > info.MaxTemp || temp < info.MinTemp {
-		return &info.MaxTemp, fmt.Errorf("invalid max temperature")
-	}
-	info.MaxTemp = temp
-	err = c.save(ctx, info)
 	return &info.MaxTemp, err
 }
 
+// Sets the rule in the active profile
 func (c *Boiler) SetRule(ctx context.Context, opt *Rule) (*Rule, error) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	info, err := c.GetInfo(ctx)
-	if err != nil {
-		return nil, err
-	}
-	if opt.TargetTemp < info.MinTemp || opt.TargetTemp > info.MaxTemp {
-		return nil, fmt.Errorf("target temperature out of bounds")
-	}
+	return c.SetProfileRule(ctx, "", opt)
+}
 
-	// Map programmed intervals to a map for easier lookup
-	lookupRules := make(map[string]*Rule)
-	for _, interval := range info.Rules {
-		lookupRules[interval.ID] = interval
+// Sets the rule in the named profile, an empty name is the active profile
+func (c *Boiler) SetProfileRule(ctx context.Context, profile string, opt *Rule) (*Rule, error) {
+	if (opt.HysteresisLower != nil && *opt.HysteresisLower < 0) || (opt.HysteresisUpper != nil && *opt.HysteresisUpper < 0) {
+		return nil, fmt.Errorf("hysteresis margins cannot be negative")
+	}
+	// Only the hysteresis strategy reads them, they would be silently ignored
+	if (opt.HysteresisLower != nil || opt.HysteresisUpper != nil) && c.Config.Control.Strategy != "hysteresis" {
+		return nil, fmt.Errorf("hysteresis margins are only used by the hysteresis control strategy, not by the one of boiler %s", c.Config.Name)
 	}
-
 	// If ID is present in the opt, use that, otherwise generate a new one
 	if opt.ID == "" {
 		// Create ours if not present
 		opt.ID = fmt.Sprintf("%d", time.Now().UnixNano())
 	}
-	lookupRules[opt.ID] = opt
-
-	// Convert back to a slice
-	rule := make([]*Rule, 0, len(lookupRules))
-	for _, interval := range lookupRules {
-		rule = append(rule, interval)
+	if opt.Kind == "" {
+		opt.Kind = RuleKindHeat
+	}
+	if !opt.Kind.IsValid() {
+		return nil, fmt.Errorf("invalid rule kind: %s", opt.Kind)
+	}
+	// Clients often send a bare UTC offset, the time of day is kept at home
+	opt.Start = opt.Start.In(c.location())
+	if err := opt.validateRecurrence(); err != nil {
+		return nil, err
 	}
-	info.Rules = rule
-
-	err = c.save(ctx, info)
-	return opt, err
-}
 
-func (c *Boiler) StartRule(ctx context.Context, id string) (*Rule, error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	info, err := c.GetInfo(ctx)
+	var rules *[]*Rule
+	_, err := c.update(ctx, AuditKindRule, func(info *BoilerInfo) error {
+		// Inhibiting rules never heat, their target doesn't matter
+		if !opt.IsInhibit() && (opt.TargetTemp < info.MinTemp || opt.TargetTemp > info.MaxTemp) {
+			return fmt.Errorf("target temperature out of bounds")
+		}
+		var err error
+		rules, err = profileRules(info, profile)
+		if err != nil {
+			return err
+		}
+
+		// Map programmed intervals to a map for easier lookup
+		lookupRules := make(map[string]*Rule)
+		for _, interval := range *rules {
+			lookupRules[interval.ID] = interval
+		}
+		lookupRules[opt.ID] = opt
+
+		// Convert back to a slice
+		rule := make([]*Rule, 0, len(lookupRules))
+		for _, interval := range lookupRules {
+			rule = append(rule, interval)
+		}
+		*rules = rule
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	opt.Warnings = RuleWarnings(opt, *rules, time.Now())
+	for _, warning := range opt.Warnings {
+		fmt.Printf("⚠️  Rule %s %s\n", opt.ID, warning)
+	}
+	return opt, nil
+}
 
+func (c *Boiler) StartRule(ctx context.Context, id string) (*Rule, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	alteredRule := &Rule{}
-	for _, rule := range info.Rules {
-		err = fmt.Errorf("could not find rule with id: %s", id)
-		if rule.ID == id {
-			rule.IsActive = true
-			alteredRule = rule
-			err = nil
-			break
+	_, err := c.update(ctx, AuditKindRule, func(info *BoilerInfo) error {
+		for _, rule := range info.Rules {
+			if rule.ID == id {
+				rule.IsActive = true
+				alteredRule = rule
+				return nil
+			}
 		}
-	}
+		return fmt.Errorf("could not find rule with id: %s", id)
+	})
 	if err != nil {
 		return alteredRule, err
 	}
-
-	c.save(ctx, info)
-	for _, rule := range info.Rules {
-		if rule.ID == id {
-			fmt.Printf("🔥 Started programmed interval %s\n", rule)
-		}
-	}
+	fmt.Printf("🔥 Started programmed interval %s\n", alteredRule)
 	return alteredRule, nil
 }
 
 func (c *Boiler) StopRule(ctx context.Context, id string) (*Rule, error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	info, err := c.GetInfo(ctx)
-	if err != nil {
-		return nil, err
-	}
-
 	alteredInterval := &Rule{}
-	for _, rule := range info.Rules {
-		err = fmt.Errorf("could not find rule with id: %s", id)
-		if rule.ID == id {
-			stopTime := time.Now()
-			rule.StoppedTime = &stopTime
-			rule.IsActive = false
-			alteredInterval = rule
-			err = nil
-			break
+	_, err := c.update(ctx, AuditKindRule, func(info *BoilerInfo) error {
+		for _, rule := range info.Rules {
+			if rule.ID == id {
+				stopTime := time.Now()
+				rule.StoppedTime = &stopTime
+				rule.IsActive = false
+				alteredInterval = rule
+				return nil
+			}
 		}
-	}
+		return fmt.Errorf("could not find rule with id: %s", id)
+	})
 	if err != nil {
 		return alteredInterval, err
 	}
-	c.save(ctx, info)
 	fmt.Printf("💤 Stopped programmed interval %s\n", alteredInterval)
 	return alteredInterval, nil
 }
 
+// Deletes the rule from the active profile
 func (c *Boiler) DeleteRule(ctx context.Context, id string) error {
+	return c.DeleteProfileRule(ctx, "", id)
+}
+
+// Deletes the rule from the named profile, an empty name is the active profile
+func (c *Boiler) DeleteProfileRule(ctx context.Context, profile string, id string) error {
 	fmt.Printf("Deleting rule %s\n", id)
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	info, err := c.GetInfo(ctx)
-	if err != nil {
-		return err
-	}
-
-	for index, rule := range info.Rules {
-		err = fmt.Errorf("could not find programmed interval with id: %s", id)
-		if rule.ID == id {
-			info.Rules = append(info.Rules[:index], info.Rules[index+1:]...)
-			err = nil
-			break
+	_, err := c.update(ctx, AuditKindRule, func(info *BoilerInfo) error {
+		rules, err := profileRules(info, profile)
+		if err != nil {
+			return err
 		}
-	}
-	if err != nil {
-		return err
-	}
-
-	err = c.save(ctx, info)
+		for index, rule := range *rules {
+			if rule.ID == id {
+				*rules = append((*rules)[:index], (*rules)[index+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("could not find programmed interval with id: %s", id)
+	})
 	return err
 }
 
@@ -320,26 +482,25 @@ func (c *Boiler) ListenOverheating(ctx context.Context) (<-chan bool, error) {
 }
 
 func (c *Boiler) Listen(ctx context.Context) (<-chan *BoilerInfo, error) {
+	messages, err := c.client.Subscribe(ctx, c.Config.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to control PubSub: %w", err)
+	}
 	boilerUpdates := make(chan *BoilerInfo)
 	go func() {
 		defer close(boilerUpdates)
-		sub := c.client.Subscribe(ctx, c.Config.Name)
-		defer sub.Close()
 		defer fmt.Println("👋 bye bye Mr American Pie...")
 
-		if _, err := sub.Receive(ctx); err != nil {
-			fmt.Printf("failed to receive from control PubSub: %s", err)
-			return
-		}
-
-		redisChannel := sub.Channel()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case msg := <-redisChannel:
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
 				boiler := BoilerInfo{}
-				err := json.Unmarshal([]byte(msg.Payload), &boiler)
+				err := json.Unmarshal(msg, &boiler)
 				if err != nil {
 					fmt.Println(err)
 					return
@@ -357,10 +518,17 @@ func (c *Boiler) Listen(ctx context.Context) (<-chan *BoilerInfo, error) {
 }
 
 func (c *Boiler) GetInfo(ctx context.Context) (*BoilerInfo, error) {
-	data, err := c.client.Get(ctx, c.Config.Name).Result()
+	_, info, err := c.read(ctx)
+	return info, err
+}
+
+// The stored state as it is, to compare against when saving, and parsed
+func (c *Boiler) read(ctx context.Context) ([]byte, *BoilerInfo, error) {
+	data, err := c.client.Get(ctx, c.Config.Name)
 	switch err {
-	case redis.Nil: // Data doesn't exist yet
+	case storage.Nil: // Data doesn't exist yet
 		defaultInfo := &BoilerInfo{
+			Name:    c.Config.Name,
 			State:   StateUnknown,
 			MinTemp: c.Config.DefaultMinTemperature,
 			MaxTemp: c.Config.DefaultMaxTemperature,
@@ -368,24 +536,68 @@ func (c *Boiler) GetInfo(ctx context.Context) (*BoilerInfo, error) {
 		}
 		data, err := json.Marshal(defaultInfo)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		err = c.client.Set(ctx, c.Config.Name, data, 0).Err()
+		created, err := c.client.CompareAndSet(ctx, c.Config.Name, nil, data)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		if !created {
+			// Somebody else got there first
+			return c.read(ctx)
 		}
-		return defaultInfo, err
+		return data, defaultInfo, c.fillDerivedStatus(ctx, defaultInfo)
 	case nil: // No error
 		var info BoilerInfo
-		err := json.Unmarshal([]byte(data), &info)
-		return &info, err
+		err := json.Unmarshal(data, &info)
+		if err != nil {
+			return nil, nil, err
+		}
+		info.Name = c.Config.Name // Not there in data saved before zones
+		return data, &info, c.fillDerivedStatus(ctx, &info)
 	default:
-		return nil, err
+		return nil, nil, err
+	}
+}
+
+// Worker, relay and rule status aren't stored with the state, they are worked out when reading it
+func (c *Boiler) fillDerivedStatus(ctx context.Context, info *BoilerInfo) error {
+	syncProfiles(info)
+	fillRuleStatus(info, time.Now(), c.location())
+	err := c.fillWorkerStatus(ctx, info)
+	if err != nil {
+		return err
 	}
+	return c.fillRelayStatus(ctx, info)
+}
+
+// Stored times only keep their UTC offset, rules get their timezone back.
+// Rules only warn about the rules of their own profile.
+func fillRuleStatus(info *BoilerInfo, now time.Time, location *time.Location) {
+	for _, profile := range info.Profiles {
+		if profile.Rules == nil {
+			profile.Rules = []*Rule{}
+		}
+		for _, rule := range profile.Rules {
+			if rule.Kind == "" {
+				rule.Kind = RuleKindHeat // Stored before kinds existed
+			}
+			rule.Start = rule.Start.In(location)
+		}
+	}
+	info.RuleInControl = RuleInControl(ActiveRules(info.Rules))
+	// Rules are suspended while away, and everything while boosting
+	if info.Away.IsActive(now) {
+		info.RuleInControl = info.Away.Rule()
+	}
+	if info.Boost.IsActive(now) {
+		info.RuleInControl = info.Boost.Rule()
+	}
+	fillBoostStatus(info, now)
 }
 
 func (c *Boiler) GetSwitchHistory(ctx context.Context, from time.Time, to time.Time) ([]*SwitchSample, error) {
-	parseSwitchSample := func(sample redis.TSTimestampValue) SwitchSample {
+	parseSwitchSample := func(sample storage.Sample) SwitchSample {
 		return SwitchSample{
 			Time:  time.UnixMilli(sample.Timestamp),
 			State: AllState[int(sample.Value)],
@@ -400,7 +612,7 @@ func (c *Boiler) GetSwitchHistory(ctx context.Context, from time.Time, to time.T
 }
 
 func (c *Boiler) GetOverheatingProtectionHistory(ctx context.Context, from time.Time, to time.Time) ([]*OverheatingProtectionSample, error) {
-	parseOverheatingSample := func(sample redis.TSTimestampValue) OverheatingProtectionSample {
+	parseOverheatingSample := func(sample storage.Sample) OverheatingProtectionSample {
 		isActive := false
 		if sample.Value == 1 {
 			isActive = true
@@ -418,66 +630,167 @@ func (c *Boiler) GetOverheatingProtectionHistory(ctx context.Context, from time.
 	return readTimeSeries(ctx, c.client, c.protectionSeriesKey, from, to, parseOverheatingSample, useDefault, defaultOverheatingSample)
 }
 
-func (c *Boiler) save(ctx context.Context, info *BoilerInfo) error {
-	// Serialise data
-	data, err := json.Marshal(info)
-	if err != nil {
-		return err
-	}
-
-	// If there is diff set
-	storedData, err := c.client.Get(ctx, c.Config.Name).Result()
-	if err != nil && err != redis.Nil {
-		return fmt.Errorf("cannot update database. Error when getting current state: %w", err)
-	}
-	diff := cmp.Diff([]byte(storedData), data)
-	if diff != "" {
-		// If we are about to save something different from what we have in the database then save
-		err = c.client.Set(ctx, c.Config.Name, data, 0).Err()
+// Applies change to the latest state and saves it unless somebody else saved
+// in between, in which case it starts over with their state. change may run
+// more than once and must only touch info. Returns ErrConflict once
+// MAX_UPDATE_ATTEMPTS are used up.
+func (c *Boiler) update(ctx context.Context, kind AuditKind, change func(info *BoilerInfo) error) (*BoilerInfo, error) {
+	for attempt := 1; ; attempt++ {
+		storedData, info, err := c.read(ctx)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		// Add mapped switch sample
-		stateIndex := GetStateIndex(info.State)
-		timestampNow := int(time.Now().UnixMilli())
-		err = c.client.TSAdd(ctx, c.switchSeriesKey, timestampNow, float64(stateIndex)).Err()
+		err = change(info)
 		if err != nil {
-			return err
-		}
-		// Add overheating status sample
-		overheating := 0.0
-		if info.IsOverheatingProtectionActive {
-			overheating = 1.0
+			return info, err
 		}
-		err = c.client.TSAdd(ctx, c.protectionSeriesKey, timestampNow, overheating).Err()
+		saved, err := c.save(ctx, kind, storedData, info)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if saved {
+			return info, nil
 		}
+		if err := c.backOff(ctx, attempt); err != nil {
+			return nil, err
+		}
+	}
+}
 
-		// Schedule a new state message. This is delayed in case we make batch updates to the state
-		go c.batchPublish(data)
+// Waits before trying again after attempt lost the race to save. Returns
+// ErrConflict once MAX_UPDATE_ATTEMPTS are used up.
+func (c *Boiler) backOff(ctx context.Context, attempt int) error {
+	if attempt >= MAX_UPDATE_ATTEMPTS {
+		return fmt.Errorf("%w: gave up saving %s after %d attempts", ErrConflict, c.Config.Name, attempt)
 	}
-	return err
+	// Back off a bit more every time, jittered so competing writers spread out
+	backoff := time.Duration(attempt) * updateRetryBackoff
+	select {
+	case <-time.After(backoff/2 + rand.N(backoff)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Saves info only if storedData is still what is stored. Returns false when
+// somebody else saved in between.
+func (c *Boiler) save(ctx context.Context, kind AuditKind, storedData []byte, info *BoilerInfo) (bool, error) {
+	// Serialise data, without the worker, relay and rule status that change
+	// on every heartbeat, acknowledgement and as time goes by
+	info.CommandedState = info.State
+	stored := *info
+	stored.WorkerOnline = false
+	stored.LastWorkerHeartbeat = nil
+	stored.CommandedState = ""
+	stored.ActualState = ""
+	stored.LastAckTime = nil
+	stored.RuleInControl = nil
+	if info.Boost != nil {
+		storedBoost := *info.Boost
+		storedBoost.MinutesLeft = 0
+		stored.Boost = &storedBoost
+	}
+	// The rules of the active profile are only stored once, in Rules
+	syncProfiles(info)
+	stored.Rules = storedRules(info.Rules)
+	stored.Profiles = make([]*Profile, len(info.Profiles))
+	for i, profile := range info.Profiles {
+		storedProfile := Profile{Name: profile.Name}
+		if profile.Name != info.ActiveProfile {
+			storedProfile.Rules = storedRules(profile.Rules)
+		}
+		stored.Profiles[i] = &storedProfile
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return false, err
+	}
+	// Nothing to do if nothing changed
+	diff := cmp.Diff(storedData, data)
+	if diff == "" {
+		return true, nil
+	}
+
+	stored.Version++
+	data, err = json.Marshal(stored)
+	if err != nil {
+		return false, err
+	}
+	saved, err := c.client.CompareAndSet(ctx, c.Config.Name, storedData, data)
+	if err != nil || !saved {
+		return false, err
+	}
+	info.Version = stored.Version
+
+	// Schedule a new state message. This is delayed in case we make batch updates to the state
+	message, err := json.Marshal(info)
+	if err != nil {
+		return true, err
+	}
+	go c.batchPublish(message)
+
+	// Add mapped switch sample
+	stateIndex := GetStateIndex(info.State)
+	timestampNow := time.Now().UnixMilli()
+	err = c.client.TSAdd(ctx, c.switchSeriesKey, timestampNow, float64(stateIndex))
+	if err != nil {
+		return true, err
+	}
+	// Add overheating status sample
+	overheating := 0.0
+	if info.IsOverheatingProtectionActive {
+		overheating = 1.0
+	}
+	err = c.client.TSAdd(ctx, c.protectionSeriesKey, timestampNow, overheating)
+	if err != nil {
+		return true, err
+	}
+
+	var before BoilerInfo
+	err = json.Unmarshal(storedData, &before)
+	if err != nil {
+		return true, err
+	}
+	// The change is saved and announced already, a missing audit entry must not fail it
+	err = c.audit(ctx, kind, before, stored)
+	if err != nil {
+		fmt.Println(fmt.Errorf("could not audit %s change of %s: %w", kind, c.Config.Name, err))
+	}
+	return true, nil
+}
+
+// Copies without the warnings, they are worked out for the API
+func storedRules(rules []*Rule) []*Rule {
+	stored := make([]*Rule, len(rules))
+	for i, rule := range rules {
+		storedRule := *rule
+		storedRule.Warnings = nil
+		stored[i] = &storedRule
+	}
+	return stored
 }
 
 func (c *Boiler) batchPublish(data []byte) error {
+	c.publishLock.Lock()
 	if c.stateUpdateCancel != nil {
 		c.stateUpdateCancel()
 	}
 	cancelContext, cancelContextFunction := context.WithCancel(context.Background())
 	c.stateUpdateCancel = cancelContextFunction
+	c.publishLock.Unlock()
 	select {
 	case <-cancelContext.Done():
 		return nil
 	case <-time.After(time.Microsecond * stateUpdateBatchingTime):
-		return c.client.Publish(cancelContext, c.Config.Name, data).Err()
+		return c.client.Publish(cancelContext, c.Config.Name, data)
 	}
 }
 
-func readTimeSeries[T any](ctx context.Context, client *redis.Client, key string, from time.Time, to time.Time, parse func(v redis.TSTimestampValue) T, useInitSample bool, defaultInitSample T) ([]*T, error) {
-	fromTimestamp := int(from.UnixMilli())
-	toTimestamp := int(to.UnixMilli())
-	data, err := client.TSRange(ctx, key, fromTimestamp, toTimestamp).Result()
+func readTimeSeries[T any](ctx context.Context, client storage.TimeSeries, key string, from time.Time, to time.Time, parse func(v storage.Sample) T, useInitSample bool, defaultInitSample T) ([]*T, error) {
+	fromTimestamp := from.UnixMilli()
+	toTimestamp := to.UnixMilli()
+	data, err := client.TSRange(ctx, key, fromTimestamp, toTimestamp)
 	if err != nil {
 		return nil, err
 	}
@@ -488,8 +801,7 @@ func readTimeSeries[T any](ctx context.Context, client *redis.Client, key string
 	if useInitSample {
 		// Establish initSample
 		extraCount = 1
-		optLimitToLast := &redis.TSRevRangeOptions{Count: 1}
-		backData, err := client.TSRevRangeWithArgs(ctx, key, 0, fromTimestamp, optLimitToLast).Result()
+		backData, err := client.TSRevRange(ctx, key, 0, fromTimestamp, 1)
 		if err != nil {
 			return nil, err
 		}
@@ -499,7 +811,7 @@ func readTimeSeries[T any](ctx context.Context, client *redis.Client, key string
 		case 0:
 			initSample = defaultInitSample
 		default:
-			return nil, fmt.Errorf("Unexpected redis behaviour, wanted 0 or 1 element got %d", len(backData))
+			return nil, fmt.Errorf("Unexpected storage behaviour, wanted 0 or 1 element got %d", len(backData))
 		}
 	}
 
@@ -507,8 +819,8 @@ func readTimeSeries[T any](ctx context.Context, client *redis.Client, key string
 	if useInitSample {
 		samples[0] = &initSample
 	}
-	for i, redisSample := range data {
-		sample := parse(redisSample)
+	for i, storedSample := range data {
+		sample := parse(storedSample)
 		samples[i+extraCount] = &sample
 	}
 
@@ -14,7 +14,7 @@ func TestSetSwitchOn(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = testBoiler.Switch(ctx, model.StateOn)
+	_, err = testBoiler.Switch(ctx, model.StateOn, false)
 	if err != nil {
 		t.Fatalf("Could not switch boiler on: %v", err)
 	}
@@ -113,6 +113,31 @@ func TestSetAndDeleteRule(t *testing.T) {
 	}
 }
 
+func TestRuleHysteresisMargins(t *testing.T) {
+	ctx := context.Background()
+	margin := 0.5
+	rule := func() *model.Rule {
+		return &model.Rule{Start: time.Now(), Duration: time.Second, TargetTemp: testutils.MAX_TEMP, HysteresisLower: &margin}
+	}
+
+	// The default threshold strategy would ignore them
+	boiler, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := boiler.SetRule(ctx, rule()); err == nil {
+		t.Fatal("Shouldn't be able to set hysteresis margins with the threshold strategy")
+	}
+
+	boiler, err = testutils.CreateTestBoilerWithConfig(ctx, t, model.BoilerConfig{Control: model.ControlConfig{Strategy: "hysteresis"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := boiler.SetRule(ctx, rule()); err != nil {
+		t.Fatalf("Expected hysteresis margins to be accepted but got %v", err)
+	}
+}
+
 func TestSetRuleAndUpdate(t *testing.T) {
 	ctx := context.Background()
 	boiler, err := testutils.CreateTestBoiler(ctx, t)
@@ -209,15 +234,23 @@ func TestGetSwitchHistory(t *testing.T) {
 	}
 	iWant := []model.State{model.StateOff, model.StateOn, model.StateOff}
 	for _, state := range iWant {
-		boiler.Switch(ctx, state)
+		boiler.Switch(ctx, state, false)
 		time.Sleep(time.Millisecond)
 	}
 
 	aSecondAgo := time.Now().Add(-time.Hour)
 	samples, err := boiler.GetSwitchHistory(ctx, aSecondAgo, time.Now())
-	if len(samples) != len(iWant) {
-		t.Fatalf("Expected %d states but got %d", len(iWant), len(samples))
+	if err != nil {
+		t.Fatal(err)
 	}
+	// History always begins with the state at the start of the range
+	if len(samples) != len(iWant)+1 {
+		t.Fatalf("Expected %d states but got %d", len(iWant)+1, len(samples))
+	}
+	if samples[0].State != model.StateUnknown || !samples[0].Time.Equal(aSecondAgo) {
+		t.Fatalf("Expected initial sample to be %v at %v but got %v at %v", model.StateUnknown, aSecondAgo, samples[0].State, samples[0].Time)
+	}
+	samples = samples[1:]
 	previousTime := aSecondAgo
 	for i, sample := range samples {
 		if sample.State != iWant[i] {
@@ -230,3 +263,224 @@ func TestGetSwitchHistory(t *testing.T) {
 		}
 	}
 }
+
+func TestSwitchMinOnOffTime(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoilerWithConfig(ctx, t, model.BoilerConfig{
+		MinOnSeconds:  0.2,
+		MinOffSeconds: 0.4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	boiler.Switch(ctx, model.StateOn, false)
+
+	state, err := boiler.Switch(ctx, model.StateOff, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *state != model.StateOn {
+		t.Fatal("Expected boiler to stay ON before the minimum on time")
+	}
+	info, _ := boiler.GetInfo(ctx)
+	if info.DeferredState == nil || *info.DeferredState != model.StateOff || info.DeferredUntil == nil {
+		t.Fatalf("Expected a deferred switch OFF but got %v at %v", info.DeferredState, info.DeferredUntil)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	info, _ = boiler.GetInfo(ctx)
+	if info.State != model.StateOff || info.DeferredState != nil {
+		t.Fatalf("Expected deferred switch to be applied but state is %s", info.State)
+	}
+
+	// Asking for the current state cancels the deferral
+	boiler.Switch(ctx, model.StateOn, false)
+	info, _ = boiler.GetInfo(ctx)
+	if info.DeferredState == nil {
+		t.Fatal("Expected a deferred switch ON")
+	}
+	boiler.Switch(ctx, model.StateOff, false)
+	time.Sleep(500 * time.Millisecond)
+	info, _ = boiler.GetInfo(ctx)
+	if info.State != model.StateOff || info.DeferredState != nil {
+		t.Fatalf("Expected deferral to be cancelled but state is %s", info.State)
+	}
+}
+
+func TestSwitchSafetyStop(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoilerWithConfig(ctx, t, model.BoilerConfig{
+		MinOnSeconds: 3600,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	boiler.Switch(ctx, model.StateOn, false)
+	state, _ := boiler.Switch(ctx, model.StateOff, false)
+	if *state != model.StateOn {
+		t.Fatal("Expected boiler to stay ON before the minimum on time")
+	}
+
+	// Like the failsafe OFF when every sensor goes stale right after switching ON
+	state, err = boiler.Switch(ctx, model.StateOff, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *state != model.StateOff {
+		t.Fatal("Expected a safety stop to switch OFF within the minimum on time")
+	}
+	info, _ := boiler.GetInfo(ctx)
+	if info.State != model.StateOff || info.DeferredState != nil {
+		t.Fatalf("Expected boiler OFF without deferral but got %s deferred to %v", info.State, info.DeferredState)
+	}
+}
+
+func TestSwitchMaxSwitchesPerHour(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoilerWithConfig(ctx, t, model.BoilerConfig{
+		MaxSwitchesPerHour: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range []model.State{model.StateOn, model.StateOff, model.StateOn} {
+		boiler.Switch(ctx, state, false)
+		time.Sleep(time.Millisecond)
+	}
+	state, _ := boiler.Switch(ctx, model.StateOff, false)
+	if *state != model.StateOn {
+		t.Fatal("Expected boiler to stay ON after too many switches")
+	}
+	info, _ := boiler.GetInfo(ctx)
+	if info.DeferredUntil == nil || time.Until(*info.DeferredUntil) < 59*time.Minute {
+		t.Fatalf("Expected switch to be deferred by about an hour but got %v", info.DeferredUntil)
+	}
+
+	// Overheating protection doesn't wait
+	boiler.SetOverheating(ctx, true)
+	state, _ = boiler.Switch(ctx, model.StateOff, false)
+	if *state != model.StateOff {
+		t.Fatal("Expected boiler to switch OFF straight away when protected")
+	}
+}
+
+func TestOverheatingSettings(t *testing.T) {
+	ctx := context.Background()
+	testBoiler, err := testutils.CreateTestBoilerWithConfig(ctx, t, model.BoilerConfig{
+		Overheating: model.OverheatingSettings{TauSeconds: 600},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Config values and defaults for the rest
+	settings, err := testBoiler.GetOverheatingSettings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.TauSeconds != 600 || settings.OnThreshold != model.OH_ON_THRESHOLD {
+		t.Fatalf("Unexpected default settings %+v", settings)
+	}
+
+	settings.OffThreshold = 0.95
+	_, err = testBoiler.SetOverheatingSettings(ctx, settings)
+	if err == nil {
+		t.Fatal("Expected off threshold above on threshold to be rejected")
+	}
+
+	settings.OffThreshold = 0.3
+	_, err = testBoiler.SetOverheatingSettings(ctx, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err = testBoiler.GetOverheatingSettings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.OffThreshold != 0.3 || settings.TauSeconds != 600 {
+		t.Fatalf("Settings were not saved: %+v", settings)
+	}
+}
+
+func TestRuleInControlInInfo(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	comfort, err := boiler.SetRule(ctx, &model.Rule{Start: now.Add(-time.Minute), Duration: time.Hour, TargetTemp: testutils.MAX_TEMP - 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comfort.Kind != model.RuleKindHeat || len(comfort.Warnings) != 0 {
+		t.Fatalf("Expected a heating rule without warnings but got %s %v", comfort.Kind, comfort.Warnings)
+	}
+	// The target of an inhibiting rule doesn't matter
+	night, err := boiler.SetRule(ctx, &model.Rule{Start: now.Add(-time.Minute), Duration: time.Hour, Kind: model.RuleKindInhibit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(night.Warnings) != 1 {
+		t.Fatalf("Expected a warning about the overlap but got %v", night.Warnings)
+	}
+
+	info, err := boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.RuleInControl == nil || info.RuleInControl.ID != night.ID {
+		t.Fatalf("Expected the inhibiting rule in control but got %v", info.RuleInControl)
+	}
+	for _, rule := range info.Rules {
+		rule = model.WithWarnings(rule, info.Rules, time.Now())
+		if len(rule.Warnings) != 1 {
+			t.Fatalf("Expected rule %s to warn about the overlap but got %v", rule.ID, rule.Warnings)
+		}
+	}
+
+	// A higher priority takes over again
+	comfort.Priority = 1
+	_, err = boiler.SetRule(ctx, comfort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.RuleInControl == nil || info.RuleInControl.ID != comfort.ID {
+		t.Fatalf("Expected the higher priority rule in control but got %v", info.RuleInControl)
+	}
+}
+
+func TestRuleStartInHomeTimezone(t *testing.T) {
+	ctx := context.Background()
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	boiler, err := testutils.CreateTestBoilerWithConfig(ctx, t, model.BoilerConfig{Location: rome})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 07:00 in Rome, sent in winter with a bare offset
+	start := time.Date(2024, 1, 8, 7, 0, 0, 0, time.FixedZone("", 3600))
+	_, err = boiler.SetRule(ctx, &model.Rule{Start: start, Duration: time.Hour, TargetTemp: testutils.MIN_TEMP, RepeatDays: []int{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := info.Rules[0]
+	if rule.Start.Location() != rome || !rule.Start.Equal(start) {
+		t.Fatalf("Expected the rule to start at %s in Rome but got %s", start, rule.Start)
+	}
+	// Still 07:00 on a summer Monday
+	summerStart := rule.WindowStartTime(time.Date(2024, 7, 8, 6, 0, 0, 0, rome))
+	if want := time.Date(2024, 7, 8, 7, 0, 0, 0, rome); !summerStart.Equal(want) {
+		t.Fatalf("Expected the rule to start at %s but got %s", want, summerStart)
+	}
+}
@@ -0,0 +1,152 @@
+package model_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/storage"
+	"stupid-caldaia/controller/testutils"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentUpdatesAcrossProcesses(t *testing.T) {
+	ctx := context.Background()
+	first, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same state, its own lock, like another process would have
+	second, err := model.NewBoiler(ctx, testutils.CreateTestStorage(), first.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := first.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rulesEach := 10
+	var wg sync.WaitGroup
+	for i, boiler := range []*model.Boiler{first, second} {
+		for j := range rulesEach {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := boiler.SetRule(ctx, &model.Rule{
+					ID:         fmt.Sprintf("%d-%d", i, j),
+					Start:      time.Now(),
+					Duration:   time.Hour,
+					TargetTemp: testutils.MAX_TEMP - 1,
+				})
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	info, err := second.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Rules) != 2*rulesEach {
+		t.Fatalf("Expected %d rules but got %d, updates were lost", 2*rulesEach, len(info.Rules))
+	}
+	if info.Version != before.Version+2*rulesEach {
+		t.Fatalf("Expected version %d but got %d", before.Version+2*rulesEach, info.Version)
+	}
+
+	// Saving the same state again is not a new version
+	_, err = first.SetMinTemp(ctx, info.MinTemp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := first.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Version != info.Version {
+		t.Fatalf("Expected version to stay %d but got %d", info.Version, after.Version)
+	}
+}
+
+// Somebody always saves right before us
+type alwaysConflicting struct {
+	storage.Storage
+}
+
+func (s alwaysConflicting) CompareAndSet(ctx context.Context, key string, expected []byte, value []byte) (bool, error) {
+	return false, nil
+}
+
+func TestUpdateConflict(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conflicting, err := model.NewBoiler(ctx, alwaysConflicting{testutils.CreateTestStorage()}, boiler.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conflicting.Switch(ctx, model.StateOn, false)
+	if !errors.Is(err, model.ErrConflict) {
+		t.Fatalf("Expected a conflict but got %v", err)
+	}
+	info, err := boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State == model.StateOn {
+		t.Fatal("Expected the conflicting switch not to be saved")
+	}
+}
+
+func TestConcurrentOverheatingSettingsUpdates(t *testing.T) {
+	ctx := context.Background()
+	first, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := model.NewBoiler(ctx, testutils.CreateTestStorage(), first.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each one changes its own setting, neither may undo the other
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := first.UpdateOverheatingSettings(ctx, func(settings *model.OverheatingSettings) {
+				settings.TauSeconds = float64(600 + i)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := second.UpdateOverheatingSettings(ctx, func(settings *model.OverheatingSettings) {
+				settings.CheckPeriodSeconds = 30
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	settings, err := first.GetOverheatingSettings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.TauSeconds < 600 || settings.CheckPeriodSeconds != 30 {
+		t.Fatalf("Expected both changes to be kept but got %+v", settings)
+	}
+}
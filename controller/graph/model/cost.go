@@ -0,0 +1,171 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// From Time on, RuleID was in control, none when nil
+type ruleControlChange struct {
+	Time   time.Time `json:"time"`
+	RuleID *string   `json:"ruleId"`
+}
+
+// Records which rule is in control from now on, nil for none
+func (c *Boiler) RecordRuleInControl(ctx context.Context, now time.Time, ruleID *string) error {
+	data, err := json.Marshal(ruleControlChange{Time: now, RuleID: ruleID})
+	if err != nil {
+		return err
+	}
+	err = c.client.JAppend(ctx, c.ruleControlKey, now.UnixMilli(), data)
+	if err != nil {
+		return fmt.Errorf("could not record the rule in control: %w", err)
+	}
+	return nil
+}
+
+// The changes between from and to, oldest first, starting with the one in
+// effect at from
+func (c *Boiler) getRuleControlChanges(ctx context.Context, from time.Time, to time.Time) ([]ruleControlChange, error) {
+	journal, err := c.client.JRevRange(ctx, c.ruleControlKey, from.UnixMilli(), to.UnixMilli(), 0)
+	if err != nil {
+		return nil, err
+	}
+	before, err := c.client.JRevRange(ctx, c.ruleControlKey, 0, from.UnixMilli()-1, 1)
+	if err != nil {
+		return nil, err
+	}
+	journal = append(journal, before...)
+	changes := make([]ruleControlChange, len(journal))
+	for i, item := range journal {
+		err := json.Unmarshal(item.Data, &changes[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	slices.Reverse(changes)
+	return changes, nil
+}
+
+// How long the burner was ON between from and to, and what it cost. The cost
+// is nil when the gas can't be estimated.
+func (c *Boiler) sessionsCost(sessions []*HeatingSession, from time.Time, to time.Time) (time.Duration, *float64) {
+	var on time.Duration
+	cost := 0.0
+	for _, session := range sessions {
+		start, end := maxTime(session.Start, from), minTime(session.End, to)
+		if !end.After(start) {
+			continue
+		}
+		on += end.Sub(start)
+		if sessionCost := c.Config.Tariff.energyCost(start, end, c.Config.Burner, c.location()); sessionCost != nil {
+			cost += *sessionCost
+		}
+	}
+	if c.Config.Burner.PowerKW <= 0 {
+		return on, nil
+	}
+	return on, &cost
+}
+
+// One per day of the home timezone, the first and last cut at from and to
+func (c *Boiler) GetHeatingCosts(ctx context.Context, from time.Time, to time.Time) ([]*DailyCost, error) {
+	to = minTime(to, time.Now())
+	sessions, err := c.GetHeatingSessions(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	costs := []*DailyCost{}
+	for start := bucketStart(from, StatsBucketDay, c.location()); start.Before(to); start = nextBucket(start, StatsBucketDay) {
+		dayFrom, dayTo := maxTime(start, from), minTime(nextBucket(start, StatsBucketDay), to)
+		on, energyCost := c.sessionsCost(sessions, dayFrom, dayTo)
+		fixedCost := c.Config.Tariff.fixedCost(dayFrom, dayTo, c.location())
+		dailyCost := &DailyCost{
+			Day:        start,
+			OnMinutes:  on.Minutes(),
+			EnergyCost: energyCost,
+			FixedCost:  fixedCost,
+		}
+		if energyCost != nil {
+			cost := *energyCost + fixedCost
+			dailyCost.Cost = &cost
+		}
+		costs = append(costs, dailyCost)
+	}
+	return costs, nil
+}
+
+// Every time a rule took control between from and to, with what heating cost
+// until the next one did
+func (c *Boiler) GetRuleRunCosts(ctx context.Context, from time.Time, to time.Time) ([]*RuleRunCost, error) {
+	to = minTime(to, time.Now())
+	if !to.After(from) {
+		return []*RuleRunCost{}, nil
+	}
+	changes, err := c.getRuleControlChanges(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := c.GetHeatingSessions(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	runs := []*RuleRunCost{}
+	for i, change := range changes {
+		start, end := maxTime(change.Time, from), to
+		if i+1 < len(changes) {
+			end = changes[i+1].Time
+		}
+		if !end.After(start) {
+			continue
+		}
+		on, cost := c.sessionsCost(sessions, start, end)
+		run := &RuleRunCost{
+			RuleID:    change.RuleID,
+			Start:     start,
+			End:       end,
+			OnMinutes: on.Minutes(),
+			Cost:      cost,
+		}
+		run.GasKWh, run.GasCubicMeters = c.Config.Burner.gas(on)
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// The month of the home timezone holding month, up to now. Its energy cost is
+// projected to the whole month at the same pace.
+func (c *Boiler) GetMonthlyCost(ctx context.Context, month time.Time) (*MonthlyCost, error) {
+	now := time.Now()
+	start := bucketStart(month, StatsBucketMonth, c.location())
+	end := nextBucket(start, StatsBucketMonth)
+	to := minTime(end, now)
+	monthlyCost := &MonthlyCost{Month: start}
+	if c.Config.Tariff.MonthlyBudget > 0 {
+		budget := c.Config.Tariff.MonthlyBudget
+		monthlyCost.Budget = &budget
+	}
+	if !to.After(start) {
+		return monthlyCost, nil // Not started yet
+	}
+	sessions, err := c.GetHeatingSessions(ctx, start, to)
+	if err != nil {
+		return nil, err
+	}
+	_, energyCost := c.sessionsCost(sessions, start, to)
+	monthlyCost.EnergyCost = energyCost
+	monthlyCost.FixedCost = c.Config.Tariff.fixedCost(start, to, c.location())
+	if energyCost == nil {
+		return monthlyCost, nil
+	}
+	cost := *energyCost + monthlyCost.FixedCost
+	elapsed := to.Sub(start).Seconds() / end.Sub(start).Seconds()
+	projectedCost := *energyCost/elapsed + c.Config.Tariff.MonthlyFee
+	monthlyCost.Cost = &cost
+	monthlyCost.ProjectedCost = &projectedCost
+	monthlyCost.OverBudget = monthlyCost.Budget != nil && projectedCost > *monthlyCost.Budget
+	return monthlyCost, nil
+}
@@ -0,0 +1,93 @@
+package model_test
+
+import (
+	"context"
+	"math"
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/testutils"
+	"testing"
+	"time"
+)
+
+func TestHeatingCosts(t *testing.T) {
+	ctx := context.Background()
+	testStorage := testutils.CreateTestStorage()
+	// 10kWh an hour at 0.1 per kWh, so 1 for every hour ON
+	boiler, err := testutils.CreateTestBoilerWithConfig(ctx, t, model.BoilerConfig{
+		Burner: model.BurnerConfig{PowerKW: 9, Efficiency: 0.9},
+		Tariff: model.TariffConfig{Price: 0.1, MonthlyBudget: 0.4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	ago := func(minutes int) time.Time { return now.Add(-time.Duration(minutes) * time.Minute) }
+
+	// ON from 2 hours to 1 hour ago, the rule in control until 90 minutes ago
+	switchSeriesKey := "switch:" + "test_boiler_" + t.Name()
+	for _, sample := range []struct {
+		at    time.Time
+		state model.State
+	}{{ago(120), model.StateOn}, {ago(60), model.StateOff}} {
+		err = testStorage.TSAdd(ctx, switchSeriesKey, sample.at.UnixMilli(), float64(model.GetStateIndex(sample.state)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ruleID := "morning"
+	err = boiler.RecordRuleInControl(ctx, ago(180), &ruleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = boiler.RecordRuleInControl(ctx, ago(90), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := boiler.GetRuleRunCosts(ctx, ago(150), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].RuleID == nil || *runs[0].RuleID != ruleID || runs[1].RuleID != nil {
+		t.Fatalf("Expected a run of the rule and one without rules but got %v", runs)
+	}
+	if !runs[0].Start.Equal(ago(150)) {
+		t.Fatalf("Expected the rule run cut at from but got %s", runs[0].Start)
+	}
+	for _, run := range runs {
+		if math.Abs(run.OnMinutes-30) > 0.01 || run.Cost == nil || math.Abs(*run.Cost-0.5) > 0.001 {
+			t.Fatalf("Expected 30 minutes ON costing 0.5 but got %v minutes costing %v", run.OnMinutes, run.Cost)
+		}
+	}
+
+	days, err := boiler.GetHeatingCosts(ctx, ago(180), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0.0
+	for _, day := range days {
+		total += *day.Cost
+	}
+	if math.Abs(total-1) > 0.001 {
+		t.Fatalf("Expected the days to cost 1 but got %v", total)
+	}
+
+	// The session may span two months early on the first day, at least half
+	// of it is enough to go over the budget
+	previous, err := boiler.GetMonthlyCost(ctx, ago(120))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := boiler.GetMonthlyCost(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	monthTotal, overBudget := *current.EnergyCost, current.OverBudget
+	if !previous.Month.Equal(current.Month) {
+		monthTotal += *previous.EnergyCost
+		overBudget = overBudget || previous.OverBudget
+	}
+	if math.Abs(monthTotal-1) > 0.001 || !overBudget {
+		t.Fatalf("Expected the month to cost 1, over the budget, but got %v %v", monthTotal, overBudget)
+	}
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+// Returns when the boiler is allowed to move to targetState without
+// short-cycling the burner. Anything in the past means now.
+func (c *Boiler) nextAllowedSwitch(ctx context.Context, info *BoilerInfo, targetState State, safety bool) (time.Time, error) {
+	now := time.Now()
+	isSafetyStop := targetState == StateOff && (safety || info.IsOverheatingProtectionActive)
+	if targetState == info.State || info.State == StateUnknown || isSafetyStop {
+		return now, nil
+	}
+	minOnTime := time.Duration(c.Config.MinOnSeconds * float64(time.Second))
+	minOffTime := time.Duration(c.Config.MinOffSeconds * float64(time.Second))
+	if minOnTime <= 0 && minOffTime <= 0 && c.Config.MaxSwitchesPerHour <= 0 {
+		return now, nil
+	}
+
+	lookBack := max(time.Hour, minOnTime, minOffTime)
+	samples, err := c.GetSwitchHistory(ctx, now.Add(-lookBack), now)
+	if err != nil {
+		return now, err
+	}
+	transitions := switchTransitions(samples)
+	return allowedSwitchTime(transitions, info.State, minOnTime, minOffTime, c.Config.MaxSwitchesPerHour, now), nil
+}
+
+// Keeps only the samples where the state actually changed to ON or OFF. The
+// series also holds a sample for every other boiler update.
+func switchTransitions(samples []*SwitchSample) []*SwitchSample {
+	transitions := []*SwitchSample{}
+	for i := 1; i < len(samples); i++ {
+		changed := samples[i].State != samples[i-1].State
+		if changed && (samples[i].State == StateOn || samples[i].State == StateOff) {
+			transitions = append(transitions, samples[i])
+		}
+	}
+	return transitions
+}
+
+func allowedSwitchTime(transitions []*SwitchSample, currentState State, minOnTime time.Duration, minOffTime time.Duration, maxSwitchesPerHour int, now time.Time) time.Time {
+	allowed := now
+	if len(transitions) > 0 {
+		lastChange := transitions[len(transitions)-1]
+		minTime := minOffTime
+		if currentState == StateOn {
+			minTime = minOnTime
+		}
+		if lastChange.State == currentState && lastChange.Time.Add(minTime).After(allowed) {
+			allowed = lastChange.Time.Add(minTime)
+		}
+	}
+
+	if maxSwitchesPerHour > 0 {
+		recent := []*SwitchSample{}
+		for _, transition := range transitions {
+			if transition.Time.After(now.Add(-time.Hour)) {
+				recent = append(recent, transition)
+			}
+		}
+		if len(recent) >= maxSwitchesPerHour {
+			// Wait for enough transitions to leave the one hour window
+			freedAt := recent[len(recent)-maxSwitchesPerHour].Time.Add(time.Hour)
+			if freedAt.After(allowed) {
+				allowed = freedAt
+			}
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllowedSwitchTime(t *testing.T) {
+	now := time.Date(2024, 1, 7, 12, 0, 0, 0, time.Local)
+	history := []*SwitchSample{
+		{Time: now.Add(-2 * time.Hour), State: StateUnknown},
+		{Time: now.Add(-50 * time.Minute), State: StateOn},
+		{Time: now.Add(-45 * time.Minute), State: StateOn}, // Not a transition
+		{Time: now.Add(-40 * time.Minute), State: StateOff},
+		{Time: now.Add(-2 * time.Minute), State: StateOn},
+	}
+
+	testCases := []struct {
+		name        string
+		minOn       time.Duration
+		minOff      time.Duration
+		maxSwitches int
+		want        time.Time
+	}{
+		{name: "No limits", want: now},
+		{name: "Min on time not reached", minOn: 5 * time.Minute, want: now.Add(3 * time.Minute)},
+		{name: "Min on time reached", minOn: time.Minute, want: now},
+		{name: "Min off time doesn't apply", minOff: 5 * time.Minute, want: now},
+		{name: "Too many switches", maxSwitches: 3, want: now.Add(10 * time.Minute)},
+		{name: "Few enough switches", maxSwitches: 4, want: now},
+		{name: "Latest limit wins", minOn: 20 * time.Minute, maxSwitches: 3, want: now.Add(18 * time.Minute)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := allowedSwitchTime(switchTransitions(history), StateOn, tc.minOn, tc.minOff, tc.maxSwitches, now)
+			if !got.Equal(tc.want) {
+				t.Fatalf("Wanted %s but got %s", tc.want, got)
+			}
+		})
+	}
+}
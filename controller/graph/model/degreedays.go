@@ -0,0 +1,141 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Heating degree days are counted below this mean outdoor temperature, in °C,
+// like the Italian gradi giorno
+const DEFAULT_DEGREE_DAY_BASE = 20.0
+
+// The configured degree day base, or DEFAULT_DEGREE_DAY_BASE
+func (c *Boiler) DegreeDayBase() float64 {
+	if c.Config.DegreeDayBase != 0 {
+		return c.Config.DegreeDayBase
+	}
+	return DEFAULT_DEGREE_DAY_BASE
+}
+
+// A day of the home timezone, cut at the ends of the interval
+type outdoorDay struct {
+	start, end  time.Time
+	share       float64 // Of the whole day, less than 1 for a day cut short
+	temperature float64 // Mean of the day
+	hasData     bool
+}
+
+// Degree days of the day, a share of them for a day cut short
+func (d outdoorDay) degreeDays(base float64) float64 {
+	return max(base-d.temperature, 0) * d.share
+}
+
+// Mean outdoor temperature of every day between from and to
+func outdoorDays(measures []*Measure, from time.Time, to time.Time, location *time.Location) []outdoorDay {
+	days := []outdoorDay{}
+	next := 0
+	for start := bucketStart(from, StatsBucketDay, location); start.Before(to); start = nextBucket(start, StatsBucketDay) {
+		end := nextBucket(start, StatsBucketDay)
+		day := outdoorDay{start: maxTime(start, from), end: minTime(end, to)}
+		day.share = day.end.Sub(day.start).Seconds() / end.Sub(start).Seconds()
+		sum, count := 0.0, 0
+		for ; next < len(measures) && measures[next].Time.Before(day.end); next++ {
+			if !measures[next].Time.Before(day.start) {
+				sum += measures[next].Value
+				count++
+			}
+		}
+		if count > 0 {
+			day.temperature, day.hasData = sum/float64(count), true
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+func degreeDayBucketStart(t time.Time, bucket DegreeDayBucket, location *time.Location) time.Time {
+	switch bucket {
+	case DegreeDayBucketDay:
+		return bucketStart(t, StatsBucketDay, location)
+	case DegreeDayBucketWeek:
+		return bucketStart(t, StatsBucketWeek, location)
+	default:
+		t = t.In(location)
+		year := t.Year()
+		if t.Month() < time.July {
+			year--
+		}
+		return time.Date(year, time.July, 1, 0, 0, 0, 0, location)
+	}
+}
+
+func nextDegreeDayBucket(start time.Time, bucket DegreeDayBucket) time.Time {
+	switch bucket {
+	case DegreeDayBucketDay:
+		return nextBucket(start, StatsBucketDay)
+	case DegreeDayBucketWeek:
+		return nextBucket(start, StatsBucketWeek)
+	default:
+		return start.AddDate(1, 0, 0)
+	}
+}
+
+// Degree days and heating per bucket. Days without outdoor data count neither
+// degree days nor heating, so they don't skew the ratio.
+func degreeDayStats(days []outdoorDay, sessions []*HeatingSession, from time.Time, to time.Time, bucket DegreeDayBucket, base float64, location *time.Location) []*DegreeDayStats {
+	stats := []*DegreeDayStats{}
+	for start := degreeDayBucketStart(from, bucket, location); start.Before(to); start = nextDegreeDayBucket(start, bucket) {
+		end := nextDegreeDayBucket(start, bucket)
+		stat := &DegreeDayStats{Start: maxTime(start, from), End: minTime(end, to)}
+		temperatureSum := 0.0
+		var on time.Duration
+		for _, day := range days {
+			if !day.hasData || day.start.Before(stat.Start) || !day.start.Before(stat.End) {
+				continue
+			}
+			stat.Days += day.share
+			stat.DegreeDays += day.degreeDays(base)
+			temperatureSum += day.temperature * day.share
+			for _, session := range sessions {
+				overlapFrom, overlapTo := maxTime(session.Start, day.start), minTime(session.End, day.end)
+				if overlapTo.After(overlapFrom) {
+					on += overlapTo.Sub(overlapFrom)
+				}
+			}
+		}
+		stat.OnMinutes = on.Minutes()
+		if stat.Days > 0 {
+			meanTemperature := temperatureSum / stat.Days
+			stat.MeanOutdoorTemperature = &meanTemperature
+		}
+		if stat.DegreeDays > 0 {
+			minutesPerDegreeDay := stat.OnMinutes / stat.DegreeDays
+			stat.MinutesPerDegreeDay = &minutesPerDegreeDay
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// Heating against the weather measured by the outdoor sensor, per bucket of
+// the home timezone
+func DegreeDays(ctx context.Context, boiler *Boiler, outdoor *Sensor, from time.Time, to time.Time, bucket DegreeDayBucket) ([]*DegreeDayStats, error) {
+	if !bucket.IsValid() {
+		return nil, fmt.Errorf("unknown degree day bucket: %s", bucket)
+	}
+	to = minTime(to, time.Now())
+	if !to.After(from) {
+		return []*DegreeDayStats{}, nil
+	}
+	measures, err := outdoor.Get(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := boiler.GetHeatingSessions(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	days := outdoorDays(measures, from, to, boiler.location())
+	return degreeDayStats(days, sessions, from, to, bucket, boiler.DegreeDayBase(), boiler.location()), nil
+}
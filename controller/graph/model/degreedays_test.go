@@ -0,0 +1,70 @@
+package model
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDegreeDayStats(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour int) time.Time { return time.Date(2024, 1, day, hour, 0, 0, 0, rome) }
+	// Monday 8th at 6°C and 14°C, the outdoor sensor is silent on Tuesday 9th
+	measures := []*Measure{
+		{Time: at(8, 6), Value: 6},
+		{Time: at(8, 14), Value: 14},
+		{Time: at(10, 10), Value: 16},
+	}
+	sessions := []*HeatingSession{
+		{Start: at(8, 6), End: at(8, 8)},
+		{Start: at(9, 6), End: at(9, 8)},
+		{Start: at(10, 6), End: at(10, 7)},
+	}
+	from := at(8, 0)
+	days := outdoorDays(measures, from, at(10, 12), rome)
+	if len(days) != 3 || !days[0].hasData || days[0].temperature != 10 || days[1].hasData || days[2].share != 0.5 {
+		t.Fatalf("Expected a day at 10°C, one without data and half of one but got %v", days)
+	}
+
+	testCases := []struct {
+		name           string
+		bucket         DegreeDayBucket
+		wantBuckets    int
+		wantStart      time.Time
+		wantDays       float64
+		wantDegreeDays float64
+		wantMinutes    float64
+	}{
+		// 10 degree days on Monday, 2 for the half Wednesday at 16°C
+		{"Day", DegreeDayBucketDay, 3, from, 1, 10, 120},
+		{"Week skips days without data", DegreeDayBucketWeek, 1, from, 1.5, 12, 180},
+		{"Season", DegreeDayBucketSeason, 1, from, 1.5, 12, 180},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := degreeDayStats(days, sessions, from, at(10, 12), tc.bucket, DEFAULT_DEGREE_DAY_BASE, rome)
+			if len(stats) != tc.wantBuckets {
+				t.Fatalf("Expected %d buckets but got %d", tc.wantBuckets, len(stats))
+			}
+			first := stats[0]
+			if !first.Start.Equal(tc.wantStart) || first.Days != tc.wantDays || math.Abs(first.DegreeDays-tc.wantDegreeDays) > 1e-9 || first.OnMinutes != tc.wantMinutes {
+				t.Fatalf("Expected %v days from %s with %v degree days and %v minutes ON but got %v", tc.wantDays, tc.wantStart, tc.wantDegreeDays, tc.wantMinutes, first)
+			}
+			if want := tc.wantMinutes / tc.wantDegreeDays; first.MinutesPerDegreeDay == nil || math.Abs(*first.MinutesPerDegreeDay-want) > 1e-9 {
+				t.Fatalf("Expected %v minutes per degree day but got %v", want, first.MinutesPerDegreeDay)
+			}
+		})
+	}
+
+	// Without data there is nothing to relate the heating to
+	stats := degreeDayStats(days, sessions, at(9, 0), at(10, 0), DegreeDayBucketDay, DEFAULT_DEGREE_DAY_BASE, rome)
+	if len(stats) != 1 || stats[0].MinutesPerDegreeDay != nil || stats[0].MeanOutdoorTemperature != nil {
+		t.Fatalf("Expected no ratio without outdoor data but got %v", stats)
+	}
+	if start := degreeDayBucketStart(at(8, 0), DegreeDayBucketSeason, rome); !start.Equal(time.Date(2023, 7, 1, 0, 0, 0, 0, rome)) {
+		t.Fatalf("Expected the season to start on the 1st of July 2023 but got %s", start)
+	}
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const DEFAULT_FROST_TEMPERATURE = 7.0 // In °C
+
+// The configured frost protection floor, or DEFAULT_FROST_TEMPERATURE
+func (c *Boiler) FrostTemperature() float64 {
+	if c.Config.FrostTemperature != 0 {
+		return c.Config.FrostTemperature
+	}
+	return DEFAULT_FROST_TEMPERATURE
+}
+
+// Records that the floor made the boiler heat, at temperature
+func (c *Boiler) RecordFrostProtection(ctx context.Context, now time.Time, temperature float64, floor float64) error {
+	data, err := json.Marshal(FrostProtectionEvent{Time: now, Temperature: temperature, Floor: floor})
+	if err != nil {
+		return err
+	}
+	err = c.client.JAppend(ctx, c.frostKey, now.UnixMilli(), data)
+	if err != nil {
+		return fmt.Errorf("could not record frost protection: %w", err)
+	}
+	return nil
+}
+
+// Oldest first, like the other histories
+func (c *Boiler) GetFrostProtectionEvents(ctx context.Context, from time.Time, to time.Time) ([]*FrostProtectionEvent, error) {
+	journal, err := c.client.JRevRange(ctx, c.frostKey, from.UnixMilli(), to.UnixMilli(), 0)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*FrostProtectionEvent, len(journal))
+	for i, item := range journal {
+		var event FrostProtectionEvent
+		err := json.Unmarshal(item.Data, &event)
+		if err != nil {
+			return nil, err
+		}
+		events[i] = &event
+	}
+	slices.Reverse(events)
+	return events, nil
+}
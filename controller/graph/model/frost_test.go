@@ -0,0 +1,42 @@
+package model_test
+
+import (
+	"context"
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/testutils"
+	"testing"
+	"time"
+)
+
+func TestFrostProtectionEvents(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoilerWithConfig(ctx, t, model.BoilerConfig{FrostTemperature: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if floor := boiler.FrostTemperature(); floor != 5 {
+		t.Fatalf("Expected the configured floor but got %.1f", floor)
+	}
+	now := time.Now()
+	for i, temperature := range []float64{4.5, 3} {
+		err := boiler.RecordFrostProtection(ctx, now.Add(time.Duration(i-2)*time.Hour), temperature, boiler.FrostTemperature())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := boiler.GetFrostProtectionEvents(ctx, now.Add(-3*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Temperature != 4.5 || events[1].Temperature != 3 || events[1].Floor != 5 {
+		t.Fatalf("Expected both events oldest first but got %v", events)
+	}
+	events, err = boiler.GetFrostProtectionEvents(ctx, now.Add(-90*time.Minute), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected only the event in range but got %v", events)
+	}
+}
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"stupid-caldaia/controller/storage"
+)
+
+// The controller and the worker tell each other they are alive
+const (
+	ControllerHeartbeat = "controller"
+	WorkerHeartbeat     = "worker"
+
+	HEARTBEAT_PERIOD  = 10 * time.Second
+	HEARTBEAT_TIMEOUT = 3 * HEARTBEAT_PERIOD // Missing this many beats means the other side is gone
+)
+
+// Used both as the key of the last heartbeat and as the channel heartbeats are sent on
+func (c *Boiler) heartbeatKey(source string) string {
+	return "heartbeat:" + source + ":" + c.Config.Name
+}
+
+func (c *Boiler) SendHeartbeat(ctx context.Context, source string, now time.Time) error {
+	data := []byte(strconv.FormatInt(now.UnixMilli(), 10))
+	err := c.client.Set(ctx, c.heartbeatKey(source), data)
+	if err != nil {
+		return err
+	}
+	return c.client.Publish(ctx, c.heartbeatKey(source), data)
+}
+
+// Nil if the source never sent one
+func (c *Boiler) GetLastHeartbeat(ctx context.Context, source string) (*time.Time, error) {
+	data, err := c.client.Get(ctx, c.heartbeatKey(source))
+	switch err {
+	case storage.Nil:
+		return nil, nil
+	case nil:
+		timestamp, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		last := time.UnixMilli(timestamp)
+		return &last, nil
+	default:
+		return nil, err
+	}
+}
+
+// Calls onChange every time the source appears or disappears, starting from
+// what its last heartbeat says. Blocks until ctx is done.
+func (c *Boiler) WatchHeartbeats(ctx context.Context, source string, timeout time.Duration, onChange func(online bool)) error {
+	heartbeats, err := c.client.Subscribe(ctx, c.heartbeatKey(source))
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s heartbeats: %w", source, err)
+	}
+	last, err := c.GetLastHeartbeat(ctx, source)
+	if err != nil {
+		return err
+	}
+	online := last != nil && time.Since(*last) < timeout
+	onChange(online)
+
+	deadline := time.NewTimer(timeout)
+	if online {
+		deadline.Reset(timeout - time.Since(*last))
+	}
+	defer deadline.Stop()
+	for {
+		select {
+		case _, ok := <-heartbeats:
+			if !ok {
+				return fmt.Errorf("%s heartbeats closed", source)
+			}
+			deadline.Reset(timeout)
+			if !online {
+				online = true
+				onChange(online)
+			}
+		case <-deadline.C:
+			if online {
+				online = false
+				onChange(online)
+			}
+			deadline.Reset(timeout)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (c *Boiler) fillWorkerStatus(ctx context.Context, info *BoilerInfo) error {
+	last, err := c.GetLastHeartbeat(ctx, WorkerHeartbeat)
+	if err != nil {
+		return err
+	}
+	info.LastWorkerHeartbeat = last
+	info.WorkerOnline = last != nil && time.Since(*last) < HEARTBEAT_TIMEOUT
+	return nil
+}
+
+// Tells listeners the state changed even if nothing stored did
+func (c *Boiler) Notify(ctx context.Context) error {
+	info, err := c.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	go c.batchPublish(data)
+	return nil
+}
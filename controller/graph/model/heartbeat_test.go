@@ -0,0 +1,93 @@
+package model_test
+
+import (
+	"context"
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/testutils"
+	"testing"
+	"time"
+)
+
+func TestWorkerHeartbeatInInfo(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.WorkerOnline || info.LastWorkerHeartbeat != nil {
+		t.Fatal("Worker should be offline before any heartbeat")
+	}
+
+	// Too old to count
+	err = boiler.SendHeartbeat(ctx, model.WorkerHeartbeat, time.Now().Add(-2*model.HEARTBEAT_TIMEOUT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.WorkerOnline || info.LastWorkerHeartbeat == nil {
+		t.Fatal("Worker should be offline with an old heartbeat")
+	}
+
+	now := time.Now()
+	err = boiler.SendHeartbeat(ctx, model.WorkerHeartbeat, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Liveness is not stored with the rest of the state
+	_, err = boiler.Switch(ctx, model.StateOn, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.WorkerOnline || !info.LastWorkerHeartbeat.Equal(now.Truncate(time.Millisecond)) {
+		t.Fatalf("Worker should be online since %v but got %v", now, info.LastWorkerHeartbeat)
+	}
+}
+
+func TestWatchHeartbeats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	boiler, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan bool, 10)
+	timeout := 200 * time.Millisecond
+	go boiler.WatchHeartbeats(ctx, model.ControllerHeartbeat, timeout, func(online bool) {
+		changes <- online
+	})
+	expect := func(want bool) {
+		t.Helper()
+		select {
+		case online := <-changes:
+			if online != want {
+				t.Fatalf("Expected online to be %v but got %v", want, online)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected online to become %v but nothing happened", want)
+		}
+	}
+
+	// Never heard of
+	expect(false)
+	// Gets there
+	time.Sleep(50 * time.Millisecond)
+	err = boiler.SendHeartbeat(ctx, model.ControllerHeartbeat, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(true)
+	// And goes silent
+	expect(false)
+}
@@ -9,12 +9,98 @@ import (
 	"time"
 )
 
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Boiler string    `json:"boiler"`
+	Kind   AuditKind `json:"kind"`
+	Actor  string    `json:"actor"`
+	Diff   string    `json:"diff"`
+}
+
+type AuditLogPage struct {
+	Entries []*AuditEntry `json:"entries"`
+	Total   int           `json:"total"`
+}
+
+type AwayMode struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	FrostTemp float64   `json:"frostTemp"`
+}
+
 type BoilerInfo struct {
-	State                         State   `json:"state"`
-	MinTemp                       float64 `json:"minTemp"`
-	MaxTemp                       float64 `json:"maxTemp"`
-	Rules                         []*Rule `json:"rules"`
-	IsOverheatingProtectionActive bool    `json:"isOverheatingProtectionActive"`
+	Name                          string         `json:"name"`
+	State                         State          `json:"state"`
+	MinTemp                       float64        `json:"minTemp"`
+	MaxTemp                       float64        `json:"maxTemp"`
+	Rules                         []*Rule        `json:"rules"`
+	IsOverheatingProtectionActive bool           `json:"isOverheatingProtectionActive"`
+	DeferredState                 *State         `json:"deferredState,omitempty"`
+	DeferredUntil                 *time.Time     `json:"deferredUntil,omitempty"`
+	WorkerOnline                  bool           `json:"workerOnline"`
+	LastWorkerHeartbeat           *time.Time     `json:"lastWorkerHeartbeat,omitempty"`
+	CommandedState                State          `json:"commandedState"`
+	ActualState                   State          `json:"actualState"`
+	LastAckTime                   *time.Time     `json:"lastAckTime,omitempty"`
+	RelayFault                    bool           `json:"relayFault"`
+	Version                       int            `json:"version"`
+	RuleInControl                 *Rule          `json:"ruleInControl,omitempty"`
+	Away                          *AwayMode      `json:"away,omitempty"`
+	ActiveProfile                 string         `json:"activeProfile"`
+	Profiles                      []*Profile     `json:"profiles"`
+	ProfileSwitch                 *ProfileSwitch `json:"profileSwitch,omitempty"`
+	Boost                         *Boost         `json:"boost,omitempty"`
+}
+
+type Boost struct {
+	TargetTemp  float64   `json:"targetTemp"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	MinutesLeft float64   `json:"minutesLeft"`
+}
+
+type DailyCost struct {
+	Day        time.Time `json:"day"`
+	OnMinutes  float64   `json:"onMinutes"`
+	EnergyCost *float64  `json:"energyCost,omitempty"`
+	FixedCost  float64   `json:"fixedCost"`
+	Cost       *float64  `json:"cost,omitempty"`
+}
+
+type DegreeDayStats struct {
+	Start                  time.Time `json:"start"`
+	End                    time.Time `json:"end"`
+	Days                   float64   `json:"days"`
+	DegreeDays             float64   `json:"degreeDays"`
+	MeanOutdoorTemperature *float64  `json:"meanOutdoorTemperature,omitempty"`
+	OnMinutes              float64   `json:"onMinutes"`
+	MinutesPerDegreeDay    *float64  `json:"minutesPerDegreeDay,omitempty"`
+}
+
+type FrostProtectionEvent struct {
+	Time        time.Time `json:"time"`
+	Temperature float64   `json:"temperature"`
+	Floor       float64   `json:"floor"`
+}
+
+type HeatingSession struct {
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	Minutes        float64   `json:"minutes"`
+	Ongoing        bool      `json:"ongoing"`
+	GasKWh         *float64  `json:"gasKWh,omitempty"`
+	GasCubicMeters *float64  `json:"gasCubicMeters,omitempty"`
+}
+
+type HeatingStats struct {
+	Start                 time.Time `json:"start"`
+	End                   time.Time `json:"end"`
+	OnMinutes             float64   `json:"onMinutes"`
+	Sessions              int       `json:"sessions"`
+	AverageSessionMinutes float64   `json:"averageSessionMinutes"`
+	DutyCycle             float64   `json:"dutyCycle"`
+	GasKWh                *float64  `json:"gasKWh,omitempty"`
+	GasCubicMeters        *float64  `json:"gasCubicMeters,omitempty"`
 }
 
 type Measure struct {
@@ -22,26 +108,89 @@ type Measure struct {
 	Time  time.Time `json:"time"`
 }
 
+type MonthlyCost struct {
+	Month         time.Time `json:"month"`
+	EnergyCost    *float64  `json:"energyCost,omitempty"`
+	FixedCost     float64   `json:"fixedCost"`
+	Cost          *float64  `json:"cost,omitempty"`
+	ProjectedCost *float64  `json:"projectedCost,omitempty"`
+	Budget        *float64  `json:"budget,omitempty"`
+	OverBudget    bool      `json:"overBudget"`
+}
+
 type Mutation struct {
 }
 
+type OverheatingIndexSample struct {
+	Index float64   `json:"index"`
+	Time  time.Time `json:"time"`
+}
+
 type OverheatingProtectionSample struct {
 	IsActive bool      `json:"isActive"`
 	Time     time.Time `json:"time"`
 }
 
+type OverheatingSettings struct {
+	TauSeconds         float64 `json:"tauSeconds"`
+	OnThreshold        float64 `json:"onThreshold"`
+	OffThreshold       float64 `json:"offThreshold"`
+	CheckPeriodSeconds float64 `json:"checkPeriodSeconds"`
+}
+
+type OverheatingStatus struct {
+	Index              float64   `json:"index"`
+	Time               time.Time `json:"time"`
+	IsProtectionActive bool      `json:"isProtectionActive"`
+	MinutesLeft        float64   `json:"minutesLeft"`
+}
+
+type Profile struct {
+	Name  string  `json:"name"`
+	Rules []*Rule `json:"rules"`
+}
+
+type ProfileSwitch struct {
+	Profile string    `json:"profile"`
+	At      time.Time `json:"at"`
+}
+
 type Query struct {
 }
 
 type Rule struct {
-	ID          string        `json:"id"`
-	Start       time.Time     `json:"start"`
-	Duration    time.Duration `json:"duration"`
-	Delay       time.Duration `json:"delay"`
-	TargetTemp  float64       `json:"targetTemp"`
-	RepeatDays  []int         `json:"repeatDays"`
-	IsActive    bool          `json:"isActive"`
-	StoppedTime *time.Time    `json:"stoppedTime,omitempty"`
+	ID              string        `json:"id"`
+	Start           time.Time     `json:"start"`
+	Duration        time.Duration `json:"duration"`
+	Delay           time.Duration `json:"delay"`
+	TargetTemp      float64       `json:"targetTemp"`
+	RepeatDays      []int         `json:"repeatDays"`
+	IsActive        bool          `json:"isActive"`
+	StoppedTime     *time.Time    `json:"stoppedTime,omitempty"`
+	HysteresisLower *float64      `json:"hysteresisLower,omitempty"`
+	HysteresisUpper *float64      `json:"hysteresisUpper,omitempty"`
+	Priority        int           `json:"priority"`
+	Kind            RuleKind      `json:"kind"`
+	Warnings        []string      `json:"warnings"`
+	Cron            *string       `json:"cron,omitempty"`
+	Rrule           *string       `json:"rrule,omitempty"`
+}
+
+type RuleRunCost struct {
+	RuleID         *string   `json:"ruleId,omitempty"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	OnMinutes      float64   `json:"onMinutes"`
+	GasKWh         *float64  `json:"gasKWh,omitempty"`
+	GasCubicMeters *float64  `json:"gasCubicMeters,omitempty"`
+	Cost           *float64  `json:"cost,omitempty"`
+}
+
+type SensorHealth struct {
+	ID               string     `json:"id"`
+	LastSeen         *time.Time `json:"lastSeen,omitempty"`
+	IsStale          bool       `json:"isStale"`
+	SamplesPerMinute float64    `json:"samplesPerMinute"`
 }
 
 type Subscription struct {
@@ -52,6 +201,152 @@ type SwitchSample struct {
 	Time  time.Time `json:"time"`
 }
 
+type WarmUpRate struct {
+	Intercept  float64   `json:"intercept"`
+	Slope      float64   `json:"slope"`
+	Sessions   int       `json:"sessions"`
+	ComputedAt time.Time `json:"computedAt"`
+}
+
+type AuditKind string
+
+const (
+	AuditKindState               AuditKind = "STATE"
+	AuditKindTemperatureLimits   AuditKind = "TEMPERATURE_LIMITS"
+	AuditKindRule                AuditKind = "RULE"
+	AuditKindOverheating         AuditKind = "OVERHEATING"
+	AuditKindOverheatingSettings AuditKind = "OVERHEATING_SETTINGS"
+	AuditKindRelayFault          AuditKind = "RELAY_FAULT"
+	AuditKindAway                AuditKind = "AWAY"
+	AuditKindProfile             AuditKind = "PROFILE"
+	AuditKindBoost               AuditKind = "BOOST"
+)
+
+var AllAuditKind = []AuditKind{
+	AuditKindState,
+	AuditKindTemperatureLimits,
+	AuditKindRule,
+	AuditKindOverheating,
+	AuditKindOverheatingSettings,
+	AuditKindRelayFault,
+	AuditKindAway,
+	AuditKindProfile,
+	AuditKindBoost,
+}
+
+func (e AuditKind) IsValid() bool {
+	switch e {
+	case AuditKindState, AuditKindTemperatureLimits, AuditKindRule, AuditKindOverheating, AuditKindOverheatingSettings, AuditKindRelayFault, AuditKindAway, AuditKindProfile, AuditKindBoost:
+		return true
+	}
+	return false
+}
+
+func (e AuditKind) String() string {
+	return string(e)
+}
+
+func (e *AuditKind) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AuditKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AuditKind", str)
+	}
+	return nil
+}
+
+func (e AuditKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type DegreeDayBucket string
+
+const (
+	DegreeDayBucketDay    DegreeDayBucket = "DAY"
+	DegreeDayBucketWeek   DegreeDayBucket = "WEEK"
+	DegreeDayBucketSeason DegreeDayBucket = "SEASON"
+)
+
+var AllDegreeDayBucket = []DegreeDayBucket{
+	DegreeDayBucketDay,
+	DegreeDayBucketWeek,
+	DegreeDayBucketSeason,
+}
+
+func (e DegreeDayBucket) IsValid() bool {
+	switch e {
+	case DegreeDayBucketDay, DegreeDayBucketWeek, DegreeDayBucketSeason:
+		return true
+	}
+	return false
+}
+
+func (e DegreeDayBucket) String() string {
+	return string(e)
+}
+
+func (e *DegreeDayBucket) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DegreeDayBucket(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DegreeDayBucket", str)
+	}
+	return nil
+}
+
+func (e DegreeDayBucket) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type RuleKind string
+
+const (
+	RuleKindHeat    RuleKind = "HEAT"
+	RuleKindInhibit RuleKind = "INHIBIT"
+)
+
+var AllRuleKind = []RuleKind{
+	RuleKindHeat,
+	RuleKindInhibit,
+}
+
+func (e RuleKind) IsValid() bool {
+	switch e {
+	case RuleKindHeat, RuleKindInhibit:
+		return true
+	}
+	return false
+}
+
+func (e RuleKind) String() string {
+	return string(e)
+}
+
+func (e *RuleKind) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RuleKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RuleKind", str)
+	}
+	return nil
+}
+
+func (e RuleKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type State string
 
 const (
@@ -94,3 +389,48 @@ func (e *State) UnmarshalGQL(v interface{}) error {
 func (e State) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
+
+type StatsBucket string
+
+const (
+	StatsBucketHour  StatsBucket = "HOUR"
+	StatsBucketDay   StatsBucket = "DAY"
+	StatsBucketWeek  StatsBucket = "WEEK"
+	StatsBucketMonth StatsBucket = "MONTH"
+)
+
+var AllStatsBucket = []StatsBucket{
+	StatsBucketHour,
+	StatsBucketDay,
+	StatsBucketWeek,
+	StatsBucketMonth,
+}
+
+func (e StatsBucket) IsValid() bool {
+	switch e {
+	case StatsBucketHour, StatsBucketDay, StatsBucketWeek, StatsBucketMonth:
+		return true
+	}
+	return false
+}
+
+func (e StatsBucket) String() string {
+	return string(e)
+}
+
+func (e *StatsBucket) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = StatsBucket(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid StatsBucket", str)
+	}
+	return nil
+}
+
+func (e StatsBucket) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
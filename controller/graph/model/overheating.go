@@ -2,19 +2,132 @@ package model
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"math"
 	"time"
+
+	"stupid-caldaia/controller/storage"
 )
 
+// Defaults, the boiler config and the API can change them
 const (
-	OH_TAU     = 720.0
-	OH_FS      = 1.0
-	OH_HISTORY = 10 * OH_TAU
+	OH_TAU           = 720.0 // In seconds
+	OH_ON_THRESHOLD  = 0.9
+	OH_OFF_THRESHOLD = 0.2
+	OH_CHECK_PERIOD  = 15.0 // In seconds
 )
 
+const (
+	OH_FS           = 1.0
+	OH_HISTORY_TAUS = 10 // Older switches don't affect the index anymore
+)
+
+// Boiler config values, falling back to the defaults
+func (c *Boiler) defaultOverheatingSettings() *OverheatingSettings {
+	settings := c.Config.Overheating
+	if settings.TauSeconds == 0 {
+		settings.TauSeconds = OH_TAU
+	}
+	if settings.OnThreshold == 0 {
+		settings.OnThreshold = OH_ON_THRESHOLD
+	}
+	if settings.OffThreshold == 0 {
+		settings.OffThreshold = OH_OFF_THRESHOLD
+	}
+	if settings.CheckPeriodSeconds == 0 {
+		settings.CheckPeriodSeconds = OH_CHECK_PERIOD
+	}
+	return &settings
+}
+
+func (s *OverheatingSettings) Validate() error {
+	if s.TauSeconds <= 0 {
+		return fmt.Errorf("overheating time constant must be positive")
+	}
+	if s.CheckPeriodSeconds <= 0 {
+		return fmt.Errorf("overheating check period must be positive")
+	}
+	// The index is always between 0 and 1 and never reaches 1
+	if s.OffThreshold <= 0 || s.OnThreshold >= 1 || s.OffThreshold >= s.OnThreshold {
+		return fmt.Errorf("overheating thresholds must satisfy 0 < off < on < 1")
+	}
+	return nil
+}
+
+func (s *OverheatingSettings) CheckPeriod() time.Duration {
+	return time.Duration(s.CheckPeriodSeconds * float64(time.Second))
+}
+
+// Settings changed through the API, or the config ones if never changed
+func (c *Boiler) GetOverheatingSettings(ctx context.Context) (*OverheatingSettings, error) {
+	_, settings, err := c.readOverheatingSettings(ctx)
+	return settings, err
+}
+
+// The settings with the stored data to compare against, nil if never changed
+func (c *Boiler) readOverheatingSettings(ctx context.Context) ([]byte, *OverheatingSettings, error) {
+	data, err := c.client.Get(ctx, c.overheatingSettingsKey)
+	switch err {
+	case storage.Nil:
+		return nil, c.defaultOverheatingSettings(), nil
+	case nil:
+		settings := &OverheatingSettings{}
+		err = json.Unmarshal(data, settings)
+		return data, settings, err
+	default:
+		return nil, nil, err
+	}
+}
+
+func (c *Boiler) SetOverheatingSettings(ctx context.Context, settings *OverheatingSettings) (*OverheatingSettings, error) {
+	return c.UpdateOverheatingSettings(ctx, func(current *OverheatingSettings) {
+		*current = *settings
+	})
+}
+
+// Applies change to the latest settings and saves them unless somebody else
+// saved in between, like the boiler state
+func (c *Boiler) UpdateOverheatingSettings(ctx context.Context, change func(settings *OverheatingSettings)) (*OverheatingSettings, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for attempt := 1; ; attempt++ {
+		storedData, before, err := c.readOverheatingSettings(ctx)
+		if err != nil {
+			return nil, err
+		}
+		settings := *before
+		change(&settings)
+		if err := settings.Validate(); err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return nil, err
+		}
+		saved, err := c.client.CompareAndSet(ctx, c.overheatingSettingsKey, storedData, data)
+		if err != nil {
+			return nil, err
+		}
+		if saved {
+			if err := c.audit(ctx, AuditKindOverheatingSettings, before, &settings); err != nil {
+				fmt.Println(fmt.Errorf("could not audit overheating settings change of %s: %w", c.Config.Name, err))
+			}
+			return &settings, nil
+		}
+		if err := c.backOff(ctx, attempt); err != nil {
+			return nil, err
+		}
+	}
+}
+
 func GetCurrentOverheatingIndex(ctx context.Context, boiler *Boiler) (float64, error) {
+	settings, err := boiler.GetOverheatingSettings(ctx)
+	if err != nil {
+		return 0, err
+	}
 	endTime := time.Now()
-	startTime := endTime.Add(-OH_HISTORY * time.Second)
+	startTime := endTime.Add(-time.Duration(OH_HISTORY_TAUS * settings.TauSeconds * float64(time.Second)))
 	samples, err := boiler.GetSwitchHistory(ctx, startTime, endTime)
 	if err != nil {
 		return 0, err
@@ -30,13 +143,103 @@ func GetCurrentOverheatingIndex(ctx context.Context, boiler *Boiler) (float64, e
 			State: info.State,
 		})
 	}
-	return calculateOverheatingIndex(samples, endTime), nil
+	return calculateOverheatingIndex(samples, endTime, settings.TauSeconds), nil
+}
+
+// Burner time left before protection trips, if the boiler were ON from now on
+func overheatingMinutesLeft(index float64, settings *OverheatingSettings) float64 {
+	if index >= settings.OnThreshold {
+		return 0
+	}
+	// The index rises as 1 - (1 - index) * exp(-t / tau)
+	return settings.TauSeconds * math.Log((1-index)/(1-settings.OnThreshold)) / 60
+}
+
+func (c *Boiler) GetOverheatingStatus(ctx context.Context) (*OverheatingStatus, error) {
+	settings, err := c.GetOverheatingSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	index, err := GetCurrentOverheatingIndex(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	info, err := c.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &OverheatingStatus{
+		Index:              index,
+		Time:               time.Now(),
+		IsProtectionActive: info.IsOverheatingProtectionActive,
+		MinutesLeft:        overheatingMinutesLeft(index, settings),
+	}
+	if status.IsProtectionActive {
+		status.MinutesLeft = 0
+	}
+	return status, nil
+}
+
+// Adds the index to its series and notifies the listeners
+func (c *Boiler) RecordOverheatingStatus(ctx context.Context, status *OverheatingStatus) error {
+	err := c.client.TSAdd(ctx, c.overheatingIndexSeriesKey, status.Time.UnixMilli(), status.Index)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	return c.client.Publish(ctx, c.overheatingIndexSeriesKey, data)
+}
+
+func (c *Boiler) GetOverheatingIndexHistory(ctx context.Context, from time.Time, to time.Time) ([]*OverheatingIndexSample, error) {
+	parseIndexSample := func(sample storage.Sample) OverheatingIndexSample {
+		return OverheatingIndexSample{
+			Time:  time.UnixMilli(sample.Timestamp),
+			Index: sample.Value,
+		}
+	}
+	useDefault := false
+	return readTimeSeries(ctx, c.client, c.overheatingIndexSeriesKey, from, to, parseIndexSample, useDefault, OverheatingIndexSample{})
+}
+
+func (c *Boiler) ListenOverheatingStatus(ctx context.Context) (<-chan *OverheatingStatus, error) {
+	messages, err := c.client.Subscribe(ctx, c.overheatingIndexSeriesKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to overheating PubSub: %w", err)
+	}
+	statusUpdates := make(chan *OverheatingStatus)
+	go func() {
+		defer close(statusUpdates)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				status := &OverheatingStatus{}
+				if err := json.Unmarshal(msg, status); err != nil {
+					fmt.Println("Error unmarshalling payload:", err)
+					continue
+				}
+				select {
+				case statusUpdates <- status:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return statusUpdates, nil
 }
 
 // As it turns out, with just a few On/Off samples over a long time period it is
 // much more efficient to simply do the maths and precisely calculate the index
 // rather than applying a transfer function.
-func calculateOverheatingIndex(samples []*SwitchSample, endTime time.Time) float64 {
+func calculateOverheatingIndex(samples []*SwitchSample, endTime time.Time, tau float64) float64 {
 	if len(samples) == 0 {
 		return 0
 	}
@@ -54,7 +257,7 @@ func calculateOverheatingIndex(samples []*SwitchSample, endTime time.Time) float
 			yn = 1.0
 		}
 
-		y = yn + (y-yn)*math.Exp(-(toTime.Sub(fromTime).Seconds()/OH_TAU))
+		y = yn + (y-yn)*math.Exp(-(toTime.Sub(fromTime).Seconds()/tau))
 
 	}
 	return y
@@ -62,7 +265,7 @@ func calculateOverheatingIndex(samples []*SwitchSample, endTime time.Time) float
 
 // Here just for reference and benchmark. This uses the discrete transfer
 // function and is much less efficient
-func calculateOverheatingIndex_TransferFunction(samples []*SwitchSample, endTime time.Time) float64 {
+func calculateOverheatingIndex_TransferFunction(samples []*SwitchSample, endTime time.Time, tau float64) float64 {
 	if len(samples) == 0 {
 		return 0
 	}
@@ -96,8 +299,8 @@ func calculateOverheatingIndex_TransferFunction(samples []*SwitchSample, endTime
 	// Actually run transfer function
 	yxn := 0.0 // Assume initial state is 0
 	ux0 := 0.0
-	alfa := (2*OH_FS*OH_TAU - 1)
-	beta := (2*OH_FS*OH_TAU + 1)
+	alfa := (2*OH_FS*tau - 1)
+	beta := (2*OH_FS*tau + 1)
 	for _, uxn := range x {
 		yxn = (1/beta)*(uxn+ux0) + yxn*(alfa/beta)
 		ux0 = uxn
@@ -25,13 +25,13 @@ var (
 
 func BenchmarkCalculateOverheatingIndex(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		calculateOverheatingIndex(benchmarkSamples, bEndTime)
+		calculateOverheatingIndex(benchmarkSamples, bEndTime, OH_TAU)
 	}
 }
 
 func BenchmarkCalculateOverheatingIndex_TransferFunction(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		calculateOverheatingIndex_TransferFunction(benchmarkSamples, bEndTime)
+		calculateOverheatingIndex_TransferFunction(benchmarkSamples, bEndTime, OH_TAU)
 	}
 }
 
@@ -109,10 +109,62 @@ func TestCalculateOverheatingIndex(t *testing.T) {
 
 	for _, ts := range testCases {
 		t.Run(ts.name+"_calculate", func(t *testing.T) {
-			got := calculateOverheatingIndex(ts.have, ts.endTime)
+			got := calculateOverheatingIndex(ts.have, ts.endTime, OH_TAU)
 			if math.Abs(got-ts.want) > ts.precision {
 				t.Fatalf("Failed to calculate overheating index. Wanted %.2f but got %.2f", ts.want, got)
 			}
 		})
 	}
 }
+
+func TestOverheatingMinutesLeft(t *testing.T) {
+	settings := &OverheatingSettings{TauSeconds: OH_TAU, OnThreshold: OH_ON_THRESHOLD, OffThreshold: OH_OFF_THRESHOLD}
+	testCases := []struct {
+		index float64
+		want  float64
+	}{
+		{0, OH_TAU * math.Log(10) / 60}, // From cold it takes ln(10) tau to reach 0.9
+		{0.9, 0},
+		{0.95, 0},
+	}
+	for _, tc := range testCases {
+		got := overheatingMinutesLeft(tc.index, settings)
+		if math.Abs(got-tc.want) > 0.01 {
+			t.Fatalf("Index %.2f: wanted %.2f minutes left but got %.2f", tc.index, tc.want, got)
+		}
+	}
+
+	// Running the boiler for the minutes left brings the index to the threshold
+	start := time.Now()
+	minutes := overheatingMinutesLeft(0, settings)
+	samples := []*SwitchSample{{Time: start, State: StateOn}}
+	index := calculateOverheatingIndex(samples, start.Add(time.Duration(minutes*float64(time.Minute))), OH_TAU)
+	if math.Abs(index-OH_ON_THRESHOLD) > 0.001 {
+		t.Fatalf("Expected the index to reach %.2f after %.1f minutes but got %.3f", OH_ON_THRESHOLD, minutes, index)
+	}
+}
+
+func TestOverheatingSettingsValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		settings OverheatingSettings
+		wantErr  bool
+	}{
+		{"Defaults", OverheatingSettings{TauSeconds: OH_TAU, OnThreshold: OH_ON_THRESHOLD, OffThreshold: OH_OFF_THRESHOLD, CheckPeriodSeconds: OH_CHECK_PERIOD}, false},
+		{"No tau", OverheatingSettings{TauSeconds: 0, OnThreshold: 0.9, OffThreshold: 0.2, CheckPeriodSeconds: 1}, true},
+		{"No check period", OverheatingSettings{TauSeconds: 1, OnThreshold: 0.9, OffThreshold: 0.2, CheckPeriodSeconds: 0}, true},
+		{"Unreachable on threshold", OverheatingSettings{TauSeconds: 1, OnThreshold: 1, OffThreshold: 0.2, CheckPeriodSeconds: 1}, true},
+		{"Off above on", OverheatingSettings{TauSeconds: 1, OnThreshold: 0.5, OffThreshold: 0.6, CheckPeriodSeconds: 1}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.settings.Validate()
+			if tc.wantErr && err == nil {
+				t.Fatal("Expected an error but got none")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
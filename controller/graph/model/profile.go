@@ -0,0 +1,182 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Active until another profile is created and activated
+const DEFAULT_PROFILE = "default"
+
+// The rules of the active profile are the ones in BoilerInfo.Rules, driving
+// the boiler. The other profiles keep theirs until they are activated.
+func syncProfiles(info *BoilerInfo) {
+	if info.ActiveProfile == "" {
+		info.ActiveProfile = DEFAULT_PROFILE // Stored before profiles existed
+	}
+	if info.Rules == nil {
+		info.Rules = []*Rule{}
+	}
+	for _, profile := range info.Profiles {
+		if profile.Name == info.ActiveProfile {
+			profile.Rules = info.Rules
+			return
+		}
+	}
+	info.Profiles = append(info.Profiles, &Profile{Name: info.ActiveProfile, Rules: info.Rules})
+}
+
+func findProfile(info *BoilerInfo, name string) *Profile {
+	for _, profile := range info.Profiles {
+		if profile.Name == name {
+			return profile
+		}
+	}
+	return nil
+}
+
+// The rules of the named profile, an empty name is the active profile
+func profileRules(info *BoilerInfo, name string) (*[]*Rule, error) {
+	if name == "" || name == info.ActiveProfile {
+		return &info.Rules, nil
+	}
+	profile := findProfile(info, name)
+	if profile == nil {
+		return nil, fmt.Errorf("unknown profile: %s", name)
+	}
+	return &profile.Rules, nil
+}
+
+// Creates an empty profile, or one with a copy of the rules of copyFrom.
+// Profiles that already exist are left as they are.
+func (c *Boiler) SetProfile(ctx context.Context, name string, copyFrom *string) (*Profile, error) {
+	if name == "" {
+		return nil, fmt.Errorf("a profile needs a name")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var profile *Profile
+	_, err := c.update(ctx, AuditKindProfile, func(info *BoilerInfo) error {
+		var rules []*Rule
+		if copyFrom != nil {
+			source := findProfile(info, *copyFrom)
+			if source == nil {
+				return fmt.Errorf("unknown profile: %s", *copyFrom)
+			}
+			for _, rule := range source.Rules {
+				copied := *rule
+				copied.IsActive = false
+				copied.StoppedTime = nil
+				rules = append(rules, &copied)
+			}
+		}
+		profile = findProfile(info, name)
+		if profile != nil {
+			if copyFrom != nil {
+				return fmt.Errorf("profile %s already exists", name)
+			}
+			return nil
+		}
+		if rules == nil {
+			rules = []*Rule{}
+		}
+		profile = &Profile{Name: name, Rules: rules}
+		info.Profiles = append(info.Profiles, profile)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func (c *Boiler) DeleteProfile(ctx context.Context, name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, err := c.update(ctx, AuditKindProfile, func(info *BoilerInfo) error {
+		if name == info.ActiveProfile {
+			return fmt.Errorf("cannot delete the active profile %s", name)
+		}
+		if info.ProfileSwitch != nil && info.ProfileSwitch.Profile == name {
+			return fmt.Errorf("cannot delete profile %s, a switch to it is scheduled", name)
+		}
+		for index, profile := range info.Profiles {
+			if profile.Name == name {
+				info.Profiles = append(info.Profiles[:index], info.Profiles[index+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown profile: %s", name)
+	})
+	return err
+}
+
+// Switches to the profile at the given time, now if it isn't in the future
+func (c *Boiler) ActivateProfile(ctx context.Context, name string, at time.Time) (*BoilerInfo, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	info, err := c.update(ctx, AuditKindProfile, func(info *BoilerInfo) error {
+		if findProfile(info, name) == nil {
+			return fmt.Errorf("unknown profile: %s", name)
+		}
+		if at.After(time.Now()) {
+			info.ProfileSwitch = &ProfileSwitch{Profile: name, At: at}
+			return nil
+		}
+		info.ProfileSwitch = nil
+		activateProfile(info, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if info.ProfileSwitch != nil {
+		fmt.Printf("📅 Switching %s to profile %s at %s\n", c.Config.Name, name, at.Format(time.DateTime))
+	} else {
+		fmt.Printf("🗂️  Profile %s of %s is active\n", name, c.Config.Name)
+	}
+	return info, nil
+}
+
+func (c *Boiler) CancelProfileSwitch(ctx context.Context) (*BoilerInfo, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.update(ctx, AuditKindProfile, func(info *BoilerInfo) error {
+		info.ProfileSwitch = nil
+		return nil
+	})
+}
+
+// Switches to the scheduled profile if it is time. Returns true when it did.
+func (c *Boiler) ApplyProfileSwitch(ctx context.Context, now time.Time) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	switched := false
+	_, err := c.update(ctx, AuditKindProfile, func(info *BoilerInfo) error {
+		switched = false
+		if info.ProfileSwitch == nil || info.ProfileSwitch.At.After(now) {
+			return nil
+		}
+		name := info.ProfileSwitch.Profile
+		info.ProfileSwitch = nil
+		if findProfile(info, name) == nil {
+			return fmt.Errorf("unknown profile: %s", name)
+		}
+		activateProfile(info, name)
+		switched = true
+		return nil
+	})
+	return switched && err == nil, err
+}
+
+// The rules of the profile left behind are kept stopped, the timing control
+// starts the ones of the new profile that should be active
+func activateProfile(info *BoilerInfo, name string) {
+	for _, rule := range info.Rules {
+		rule.IsActive = false
+	}
+	info.ActiveProfile = name
+	info.Rules = findProfile(info, name).Rules
+	syncProfiles(info)
+}
@@ -0,0 +1,103 @@
+package model_test
+
+import (
+	"context"
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/testutils"
+	"testing"
+	"time"
+)
+
+func TestProfiles(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	workweek, err := boiler.SetRule(ctx, &model.Rule{Start: now.Add(-time.Minute), Duration: time.Hour, TargetTemp: testutils.MIN_TEMP, RepeatDays: []int{1, 2, 3, 4, 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = boiler.StartRule(ctx, workweek.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ActiveProfile != model.DEFAULT_PROFILE || len(info.Profiles) != 1 || len(info.Profiles[0].Rules) != 1 {
+		t.Fatalf("Expected the rule in the default profile but got %s %v", info.ActiveProfile, info.Profiles)
+	}
+
+	// A new profile starting from the default one, with one more rule
+	defaultProfile := model.DEFAULT_PROFILE
+	_, err = boiler.SetProfile(ctx, "smart-working", &defaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = boiler.SetProfileRule(ctx, "smart-working", &model.Rule{Start: now.Add(time.Hour), Duration: time.Hour, TargetTemp: testutils.MAX_TEMP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := boiler.SetProfileRule(ctx, "holidays", &model.Rule{Start: now, Duration: time.Hour, TargetTemp: testutils.MAX_TEMP}); err == nil {
+		t.Fatal("Shouldn't be able to set a rule in an unknown profile")
+	}
+	info, err = boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Rules) != 1 {
+		t.Fatalf("Expected only the rules of the active profile to drive the boiler but got %v", info.Rules)
+	}
+
+	// Switching now swaps the rules, the ones left behind are kept stopped
+	info, err = boiler.ActivateProfile(ctx, "smart-working", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ActiveProfile != "smart-working" || len(info.Rules) != 2 {
+		t.Fatalf("Expected the two rules of smart-working but got %s %v", info.ActiveProfile, info.Rules)
+	}
+	for _, profile := range info.Profiles {
+		if profile.Name == model.DEFAULT_PROFILE && (len(profile.Rules) != 1 || profile.Rules[0].IsActive) {
+			t.Fatalf("Expected the default profile to keep its rule stopped but got %v", profile.Rules)
+		}
+	}
+	if err := boiler.DeleteProfile(ctx, "smart-working"); err == nil {
+		t.Fatal("Shouldn't be able to delete the active profile")
+	}
+
+	// A scheduled switch waits for its time
+	info, err = boiler.ActivateProfile(ctx, model.DEFAULT_PROFILE, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ActiveProfile != "smart-working" || info.ProfileSwitch == nil || info.ProfileSwitch.Profile != model.DEFAULT_PROFILE {
+		t.Fatalf("Expected a scheduled switch to the default profile but got %s %v", info.ActiveProfile, info.ProfileSwitch)
+	}
+	switched, err := boiler.ApplyProfileSwitch(ctx, now)
+	if err != nil || switched {
+		t.Fatalf("Expected no switch before its time but got %v %v", switched, err)
+	}
+	switched, err = boiler.ApplyProfileSwitch(ctx, now.Add(time.Hour))
+	if err != nil || !switched {
+		t.Fatalf("Expected the switch at its time but got %v %v", switched, err)
+	}
+	info, err = boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ActiveProfile != model.DEFAULT_PROFILE || info.ProfileSwitch != nil || len(info.Rules) != 1 {
+		t.Fatalf("Expected the default profile back but got %s %v %v", info.ActiveProfile, info.ProfileSwitch, info.Rules)
+	}
+	err = boiler.DeleteProfile(ctx, "smart-working")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
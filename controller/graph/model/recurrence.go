@@ -0,0 +1,87 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/teambition/rrule-go"
+)
+
+// When a rule starts, for rules repeating on a cron expression or an RRULE.
+// Works on wall clock readings, see wallClock.
+type recurrence interface {
+	// The first start strictly after wall, zero when there are none left
+	Next(wall time.Time) time.Time
+}
+
+type rruleRecurrence struct {
+	rule *rrule.RRule
+}
+
+func (r rruleRecurrence) Next(wall time.Time) time.Time {
+	return r.rule.After(wall, false)
+}
+
+// Starts are never before the rule start
+type notBefore struct {
+	recurrence
+	start time.Time
+}
+
+func (r notBefore) Next(wall time.Time) time.Time {
+	if wall.Before(r.start) {
+		wall = r.start.Add(-time.Nanosecond)
+	}
+	return r.recurrence.Next(wall)
+}
+
+// Nil for rules repeating on RepeatDays or not at all. Cron expressions have
+// the standard 5 fields, RRULEs take the time of day and first occurrence from
+// Start unless they have their own DTSTART. Both are read in the timezone of
+// Start.
+func (p *Rule) recurrence() (recurrence, error) {
+	location := p.Start.Location()
+	switch {
+	case p.Cron != nil && p.Rrule != nil:
+		return nil, fmt.Errorf("a rule repeats either on a cron expression or an RRULE")
+	case p.Cron != nil:
+		schedule, err := cron.ParseStandard(*p.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression: %w", err)
+		}
+		if spec, ok := schedule.(*cron.SpecSchedule); !ok || spec.Location != time.Local {
+			return nil, fmt.Errorf("cron expressions are read in the home timezone, CRON_TZ is not supported")
+		}
+		return notBefore{schedule, wallClock(p.Start)}, nil
+	case p.Rrule != nil:
+		option, err := rrule.StrToROptionInLocation(*p.Rrule, location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RRULE: %w", err)
+		}
+		if option.Dtstart.IsZero() {
+			option.Dtstart = p.Start
+		}
+		option.Dtstart = wallClock(option.Dtstart.In(location))
+		if !option.Until.IsZero() {
+			option.Until = wallClock(option.Until.In(location))
+		}
+		rule, err := rrule.NewRRule(*option)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RRULE: %w", err)
+		}
+		return rruleRecurrence{rule}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// A rule repeats on weekdays, on a cron expression or on an RRULE, and the
+// expressions must parse
+func (p *Rule) validateRecurrence() error {
+	if (p.Cron != nil || p.Rrule != nil) && len(p.RepeatDays) > 0 {
+		return fmt.Errorf("a rule repeats either on weekdays or on a cron expression or RRULE")
+	}
+	_, err := p.recurrence()
+	return err
+}
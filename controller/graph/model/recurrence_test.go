@@ -0,0 +1,143 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecurrenceWindowStartTime(t *testing.T) {
+	start := time.Date(2024, 1, 5, 18, 0, 0, 0, time.Local) // Friday
+	weekdays := "30 6,17 * * 1-5"
+	everyOtherFriday := "FREQ=WEEKLY;INTERVAL=2;BYDAY=FR"
+	firstMonday := "RRULE:FREQ=MONTHLY;BYDAY=1MO"
+	twice := "FREQ=DAILY;COUNT=2"
+
+	testCases := []struct {
+		name string
+		rule *Rule
+		now  time.Time
+		want time.Time
+	}{
+		{
+			name: "Cron in the morning window",
+			rule: &Rule{Start: start, Duration: time.Hour, Cron: &weekdays},
+			now:  time.Date(2024, 1, 8, 7, 0, 0, 0, time.Local),
+			want: time.Date(2024, 1, 8, 6, 30, 0, 0, time.Local),
+		},
+		{
+			name: "Cron between windows",
+			rule: &Rule{Start: start, Duration: time.Hour, Cron: &weekdays},
+			now:  time.Date(2024, 1, 8, 12, 0, 0, 0, time.Local),
+			want: time.Date(2024, 1, 8, 17, 30, 0, 0, time.Local),
+		},
+		{
+			name: "Cron skips the weekend",
+			rule: &Rule{Start: start, Duration: time.Hour, Cron: &weekdays},
+			now:  time.Date(2024, 1, 5, 20, 0, 0, 0, time.Local),
+			want: time.Date(2024, 1, 8, 6, 30, 0, 0, time.Local),
+		},
+		{
+			name: "Cron never starts before the rule",
+			rule: &Rule{Start: start, Duration: time.Hour, Cron: &weekdays},
+			now:  time.Date(2024, 1, 1, 7, 0, 0, 0, time.Local),
+			want: time.Date(2024, 1, 8, 6, 30, 0, 0, time.Local),
+		},
+		{
+			name: "RRULE on the Friday after the start",
+			rule: &Rule{Start: start, Duration: time.Hour, Rrule: &everyOtherFriday},
+			now:  time.Date(2024, 1, 8, 12, 0, 0, 0, time.Local),
+			want: time.Date(2024, 1, 19, 18, 0, 0, 0, time.Local),
+		},
+		{
+			name: "RRULE in the window",
+			rule: &Rule{Start: start, Duration: time.Hour, Rrule: &everyOtherFriday},
+			now:  time.Date(2024, 1, 19, 18, 30, 0, 0, time.Local),
+			want: time.Date(2024, 1, 19, 18, 0, 0, 0, time.Local),
+		},
+		{
+			name: "RRULE on the first Monday of the month",
+			rule: &Rule{Start: start, Duration: time.Hour, Rrule: &firstMonday},
+			now:  time.Date(2024, 1, 8, 12, 0, 0, 0, time.Local),
+			want: time.Date(2024, 2, 5, 18, 0, 0, 0, time.Local),
+		},
+		{
+			name: "RRULE with no occurrences left",
+			rule: &Rule{Start: start, Duration: time.Hour, Rrule: &twice},
+			now:  time.Date(2024, 1, 8, 12, 0, 0, 0, time.Local),
+			want: time.Time{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.rule.WindowStartTime(tc.now)
+			if !got.Equal(tc.want) {
+				t.Fatalf("Expected %s but got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRecurrenceShouldBeActive(t *testing.T) {
+	now := time.Now()
+	everyMinute := "* * * * *"
+	never := "FREQ=DAILY;COUNT=1"
+	active := &Rule{Start: now.Add(-time.Hour), Duration: 2 * time.Minute, Cron: &everyMinute}
+	if !active.ShouldBeActive() {
+		t.Fatal("A rule repeating every minute for two minutes should always be active")
+	}
+	over := &Rule{Start: now.Add(-time.Hour), Duration: time.Minute, Rrule: &never}
+	if over.ShouldBeActive() {
+		t.Fatal("A rule without occurrences left shouldn't be active")
+	}
+}
+
+func TestValidateRecurrence(t *testing.T) {
+	valid := "0 7 * * 1-5"
+	invalid := "every day"
+	rrule := "FREQ=WEEKLY;BYDAY=MO"
+	badRrule := "FREQ=SOMETIMES"
+
+	testCases := []struct {
+		name    string
+		rule    *Rule
+		wantErr bool
+	}{
+		{"Weekdays", &Rule{RepeatDays: []int{1}}, false},
+		{"Cron", &Rule{Cron: &valid}, false},
+		{"RRULE", &Rule{Rrule: &rrule}, false},
+		{"Invalid cron", &Rule{Cron: &invalid}, true},
+		{"Invalid RRULE", &Rule{Rrule: &badRrule}, true},
+		{"Cron and RRULE", &Rule{Cron: &valid, Rrule: &rrule}, true},
+		{"Cron and weekdays", &Rule{Cron: &valid, RepeatDays: []int{1}}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.rule.validateRecurrence()
+			if tc.wantErr && err == nil {
+				t.Fatal("Expected the recurrence to be refused")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("Expected the recurrence to be accepted but got %v", err)
+			}
+		})
+	}
+}
+
+func TestRecurrenceWarnings(t *testing.T) {
+	now := time.Date(2024, 1, 8, 12, 0, 0, 0, time.Local) // Monday
+	weekdays := "30 6,17 * * 1-5"
+	morning := &Rule{ID: "morning", Start: now, Duration: time.Hour, TargetTemp: 20, Cron: &weekdays, Kind: RuleKindHeat}
+	firstMonday := "FREQ=MONTHLY;BYDAY=1MO"
+	// Next on the 5th of February at 17:00, past the overlap horizon
+	monthly := &Rule{ID: "monthly", Start: time.Date(2024, 1, 1, 17, 0, 0, 0, time.Local), Duration: time.Hour, TargetTemp: 21, Rrule: &firstMonday, Kind: RuleKindHeat}
+	// Tuesday at 17:00, overlaps the evening window
+	tuesday := &Rule{ID: "tuesday", Start: time.Date(2024, 1, 2, 17, 0, 0, 0, time.Local), Duration: time.Hour, TargetTemp: 21, RepeatDays: []int{2}, Kind: RuleKindHeat}
+
+	rules := []*Rule{morning, monthly, tuesday}
+	if warnings := RuleWarnings(morning, rules, now); len(warnings) != 1 {
+		t.Fatalf("Expected a warning about the weekly rule only but got %v", warnings)
+	}
+	if warnings := RuleWarnings(monthly, rules, now); len(warnings) != 0 {
+		t.Fatalf("Expected no warnings but got %v", warnings)
+	}
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"stupid-caldaia/controller/storage"
+)
+
+// How long the relay can disagree with the commanded state before it is a fault
+const RELAY_ACK_TIMEOUT = 30 * time.Second
+
+// What the worker read back from the relay pin
+type RelayAck struct {
+	State State
+	Time  time.Time
+}
+
+// Used both as the key of the last acknowledgement and as the channel acknowledgements are sent on
+func (c *Boiler) relayAckKey() string {
+	return "relay-ack:" + c.Config.Name
+}
+
+func (c *Boiler) AckRelay(ctx context.Context, state State, now time.Time) error {
+	data, err := json.Marshal(RelayAck{State: state, Time: now})
+	if err != nil {
+		return err
+	}
+	err = c.client.Set(ctx, c.relayAckKey(), data)
+	if err != nil {
+		return err
+	}
+	return c.client.Publish(ctx, c.relayAckKey(), data)
+}
+
+// Nil if the worker never acknowledged
+func (c *Boiler) GetRelayAck(ctx context.Context) (*RelayAck, error) {
+	data, err := c.client.Get(ctx, c.relayAckKey())
+	switch err {
+	case storage.Nil:
+		return nil, nil
+	case nil:
+		var ack RelayAck
+		err := json.Unmarshal(data, &ack)
+		if err != nil {
+			return nil, err
+		}
+		return &ack, nil
+	default:
+		return nil, err
+	}
+}
+
+func (c *Boiler) ListenRelayAcks(ctx context.Context) (<-chan *RelayAck, error) {
+	messages, err := c.client.Subscribe(ctx, c.relayAckKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to relay acknowledgements: %w", err)
+	}
+	acks := make(chan *RelayAck)
+	go func() {
+		defer close(acks)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var ack RelayAck
+				if err := json.Unmarshal(msg, &ack); err != nil {
+					fmt.Println(err)
+					continue
+				}
+				select {
+				case acks <- &ack:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return acks, nil
+}
+
+// The actual state isn't stored with the rest of the state, it comes from
+// the last acknowledgement
+func (c *Boiler) fillRelayStatus(ctx context.Context, info *BoilerInfo) error {
+	info.CommandedState = info.State
+	info.ActualState = StateUnknown
+	info.LastAckTime = nil
+	ack, err := c.GetRelayAck(ctx)
+	if err != nil || ack == nil {
+		return err
+	}
+	info.ActualState = ack.State
+	info.LastAckTime = &ack.Time
+	return nil
+}
+
+// True when the relay is not doing what it was told. Nothing is expected
+// before the first command.
+func IsRelayMismatch(info *BoilerInfo) bool {
+	return info.CommandedState != StateUnknown && info.ActualState != info.CommandedState
+}
+
+func (c *Boiler) SetRelayFault(ctx context.Context, fault bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, err := c.update(ctx, AuditKindRelayFault, func(info *BoilerInfo) error {
+		info.RelayFault = fault
+		return nil
+	})
+	return err
+}
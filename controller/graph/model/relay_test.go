@@ -0,0 +1,56 @@
+package model_test
+
+import (
+	"context"
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/testutils"
+	"testing"
+	"time"
+)
+
+func TestRelayAckInInfo(t *testing.T) {
+	ctx := context.Background()
+	boiler, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = boiler.Switch(ctx, model.StateOn, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.CommandedState != model.StateOn || info.ActualState != model.StateUnknown || info.LastAckTime != nil {
+		t.Fatalf("Expected ON to be commanded and nothing acknowledged but got %s and %s", info.CommandedState, info.ActualState)
+	}
+	if !model.IsRelayMismatch(info) {
+		t.Fatal("Expected an unacknowledged command to be a mismatch")
+	}
+
+	now := time.Now()
+	err = boiler.AckRelay(ctx, model.StateOn, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Acknowledgements are not stored with the rest of the state
+	err = boiler.SetRelayFault(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = boiler.Switch(ctx, model.StateOff, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = boiler.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.CommandedState != model.StateOff || info.ActualState != model.StateOn || !info.LastAckTime.Equal(now) {
+		t.Fatalf("Expected OFF commanded and ON acknowledged at %v but got %s, %s at %v", now, info.CommandedState, info.ActualState, info.LastAckTime)
+	}
+	if !info.RelayFault {
+		t.Fatal("Expected the relay fault to be stored")
+	}
+}
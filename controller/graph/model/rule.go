@@ -14,7 +14,7 @@ type DayOfWeek = time.Weekday
 func (p *Rule) ShouldBeActive() bool {
 	now := time.Now()
 	wStart := p.WindowStartTime(now)
-	wEnd := wStart.Add(p.DurationWithDelay())
+	wEnd := p.windowEnd(wStart)
 	// If it shouldn't be in a stopped state and we're inside the window
 	return now.After(wStart) && now.Before(wEnd) && !p.ShouldBeStopped()
 }
@@ -23,7 +23,7 @@ func (p *Rule) ShouldBeActive() bool {
 func (p *Rule) IsBeingDelayed() bool {
 	now := time.Now()
 	wStart := p.WindowStartTime(now)
-	return now.After(wStart) && now.Before(wStart.Add(p.Delay))
+	return now.After(wStart) && now.Before(p.HeatingStartTime(wStart))
 }
 
 // It should stop if the stop command was sent in the current or upcoming window and we are past that time
@@ -34,7 +34,7 @@ func (p *Rule) ShouldBeStopped() bool {
 	}
 	now := time.Now()
 	wStart := p.WindowStartTime(now)
-	wEnd := wStart.Add(p.DurationWithDelay())
+	wEnd := p.windowEnd(wStart)
 	// Basically if
 	// 1. Last time we stopped the rule is before now
 	// 2. Last time we stopped the rule is after the window start
@@ -44,14 +44,29 @@ func (p *Rule) ShouldBeStopped() bool {
 }
 
 // Relative to the referenceTime, if we are in a window returns the start time
-// of this window, otherwise returns the start of the upcoming window
+// of this window, otherwise returns the start of the upcoming window.
+// Repeating rules start at the same time of day in the timezone of Start,
+// whatever DST does in between.
 func (p *Rule) WindowStartTime(referenceTime time.Time) time.Time {
-	if len(p.RepeatDays) == 0 {
+	location := p.Start.Location()
+	now := wallClock(referenceTime.In(location))
+	recurrence, err := p.recurrence()
+	switch {
+	case err != nil:
+		// Refused by SetRule, it never starts
+		return time.Time{}
+	case recurrence != nil:
+		// The earliest start whose window isn't over yet, zero when none is left
+		start := recurrence.Next(now.Add(-p.DurationWithDelay()))
+		if start.IsZero() {
+			return start
+		}
+		return atWallClock(start, location)
+	case len(p.RepeatDays) == 0:
 		return p.Start
 	}
-	now := referenceTime
 	daysUntilTarget := 7
-	todaysStart := time.Date(now.Year(), now.Month(), now.Day(), p.Start.Hour(), p.Start.Minute(), p.Start.Second(), p.Start.Nanosecond(), p.Start.Location())
+	todaysStart := time.Date(now.Year(), now.Month(), now.Day(), p.Start.Hour(), p.Start.Minute(), p.Start.Second(), p.Start.Nanosecond(), time.UTC)
 
 	for _, programmedWeekDay := range p.RepeatDays {
 		// Calculate the difference in days between the current day and the target day
@@ -68,8 +83,8 @@ func (p *Rule) WindowStartTime(referenceTime time.Time) time.Time {
 		}
 	}
 
-	upcomingStart := todaysStart.Add(time.Duration(daysUntilTarget) * time.Hour * 24)
-	return upcomingStart
+	upcomingStart := todaysStart.AddDate(0, 0, daysUntilTarget)
+	return atWallClock(upcomingStart, location)
 }
 
 // Sums delay and set duration
@@ -77,9 +92,20 @@ func (p *Rule) DurationWithDelay() time.Duration {
 	return p.Delay + p.Duration
 }
 
+// Delay and duration are wall clock time, a rule from 22:00 to 06:00 ends at
+// 06:00 also when the clocks change during the night. A rule starting in the
+// skipped hour lasts its whole duration from when the clocks go forward.
+func (p *Rule) HeatingStartTime(windowStart time.Time) time.Time {
+	return atWallClock(wallClock(windowStart).Add(p.Delay), windowStart.Location())
+}
+
+func (p *Rule) windowEnd(windowStart time.Time) time.Time {
+	return atWallClock(wallClock(windowStart).Add(p.DurationWithDelay()), windowStart.Location())
+}
+
 func (p *Rule) WindowStopTimeout(ctx context.Context) bool {
 	now := time.Now()
-	totalDuration := p.WindowStartTime(now).Sub(now) + p.DurationWithDelay()
+	totalDuration := p.windowEnd(p.WindowStartTime(now)).Sub(now)
 	fmt.Printf("⏰ Set stop timeout of %s for interval %s\n", totalDuration, p)
 	select {
 	case <-ctx.Done():
@@ -109,5 +135,150 @@ func (p *Rule) String() string {
 	if p.StoppedTime != nil && !p.StoppedTime.IsZero() {
 		stopTime = p.StoppedTime.Format("2006/01/02 15:04")
 	}
-	return fmt.Sprintf("\n\t- ID%s{Days %v at %s for %s target %0.f. Now active: %v, stopped: %s}", p.ID, p.RepeatDays, startTime, p.Duration, p.TargetTemp, p.IsActive, stopTime)
+	repeat := fmt.Sprintf("Days %v at %s", p.RepeatDays, startTime)
+	if p.Cron != nil {
+		repeat = fmt.Sprintf("Cron %q", *p.Cron)
+	}
+	if p.Rrule != nil {
+		repeat = fmt.Sprintf("RRULE %q", *p.Rrule)
+	}
+	return fmt.Sprintf("\n\t- ID%s{%s for %s target %0.f. Now active: %v, stopped: %s}", p.ID, repeat, p.Duration, p.TargetTemp, p.IsActive, stopTime)
+}
+
+// How far ahead rules are checked for overlaps, a bit more than a week so
+// every repetition is seen
+const OVERLAP_HORIZON = 8 * 24 * time.Hour
+
+// Rules stored before kinds existed heat
+func (p *Rule) IsInhibit() bool {
+	return p.Kind == RuleKindInhibit
+}
+
+// Whether p takes over other when both are active. The higher priority wins,
+// at the same priority inhibiting wins over heating, then the higher target.
+func (p *Rule) Overrides(other *Rule) bool {
+	if p.Priority != other.Priority {
+		return p.Priority > other.Priority
+	}
+	if p.IsInhibit() != other.IsInhibit() {
+		return p.IsInhibit()
+	}
+	return !p.IsInhibit() && p.TargetTemp > other.TargetTemp
+}
+
+// The rule deciding among the given ones, nil if there are none
+func RuleInControl(rules []*Rule) *Rule {
+	var inControl *Rule
+	for _, rule := range rules {
+		if inControl == nil || rule.Overrides(inControl) {
+			inControl = rule
+		}
+	}
+	return inControl
+}
+
+// Rules that should currently drive the boiler
+func ActiveRules(rules []*Rule) []*Rule {
+	active := []*Rule{}
+	for _, rule := range rules {
+		if rule.ShouldBeActive() && !rule.IsBeingDelayed() {
+			active = append(active, rule)
+		}
+	}
+	return active
+}
+
+type window struct {
+	start time.Time
+	end   time.Time
+}
+
+// When the rule is in control, after its delay, for the windows ending after
+// from and starting before to
+func (p *Rule) controlWindows(from time.Time, to time.Time) []window {
+	windows := []window{}
+	location := p.Start.Location()
+	add := func(windowStart time.Time) {
+		start := p.HeatingStartTime(windowStart)
+		end := p.windowEnd(windowStart)
+		if end.After(from) && start.Before(to) {
+			windows = append(windows, window{start, end})
+		}
+	}
+	// Walk the wall clock, a bit earlier so windows already started are seen
+	first := wallClock(from.In(location)).Add(-p.DurationWithDelay())
+	last := wallClock(to.In(location))
+	recurrence, err := p.recurrence()
+	switch {
+	case err != nil:
+		return windows
+	case recurrence != nil:
+		for start := recurrence.Next(first); !start.IsZero() && start.Before(last); start = recurrence.Next(start) {
+			add(atWallClock(start, location))
+		}
+		return windows
+	case len(p.RepeatDays) == 0:
+		add(p.Start)
+		return windows
+	}
+	for day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.UTC); day.Before(last); day = day.AddDate(0, 0, 1) {
+		for _, repeatDay := range p.RepeatDays {
+			if repeatDay%7 == int(day.Weekday()) {
+				add(atWallClock(time.Date(day.Year(), day.Month(), day.Day(), p.Start.Hour(), p.Start.Minute(), p.Start.Second(), p.Start.Nanosecond(), time.UTC), location))
+				break
+			}
+		}
+	}
+	return windows
+}
+
+// Windows come sorted and all last the same for a rule, so both lists can be
+// walked once even for rules repeating every few minutes
+func overlapping(windows []window, others []window) bool {
+	i, j := 0, 0
+	for i < len(windows) && j < len(others) {
+		switch {
+		case !windows[i].end.After(others[j].start):
+			i++
+		case !others[j].end.After(windows[i].start):
+			j++
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// A copy of the rule with its warnings about the others. They compare every
+// pair of rules, so they are only worked out when a client asks for them.
+func WithWarnings(rule *Rule, rules []*Rule, now time.Time) *Rule {
+	withWarnings := *rule
+	withWarnings.Warnings = RuleWarnings(rule, rules, now)
+	return &withWarnings
+}
+
+// The other rules the rule overlaps with from now on, and which one is in
+// control where they do
+func RuleWarnings(rule *Rule, rules []*Rule, now time.Time) []string {
+	warnings := []string{}
+	horizon := now.Add(OVERLAP_HORIZON)
+	windows := rule.controlWindows(now, horizon)
+	for _, other := range rules {
+		if other.ID == rule.ID || !overlapping(windows, other.controlWindows(now, horizon)) {
+			continue
+		}
+		switch {
+		case other.Priority > rule.Priority:
+			warnings = append(warnings, fmt.Sprintf("overlaps rule %s, which takes over with higher priority %d", other.ID, other.Priority))
+		case other.Overrides(rule) && other.IsInhibit():
+			warnings = append(warnings, fmt.Sprintf("overlaps rule %s, which inhibits heating at the same priority", other.ID))
+		case other.Overrides(rule):
+			warnings = append(warnings, fmt.Sprintf("overlaps rule %s, which takes over with higher target %.1f°C at the same priority", other.ID, other.TargetTemp))
+		case rule.Overrides(other):
+			warnings = append(warnings, fmt.Sprintf("overlaps rule %s, which this rule takes over", other.ID))
+		default:
+			warnings = append(warnings, fmt.Sprintf("overlaps rule %s with the same priority and target", other.ID))
+		}
+	}
+	return warnings
 }
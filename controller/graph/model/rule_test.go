@@ -242,3 +242,81 @@ func TestIsBeingDelayed(t *testing.T) {
 		})
 	}
 }
+
+func TestRuleInControl(t *testing.T) {
+	eco := &Rule{ID: "eco", TargetTemp: 17, Kind: RuleKindHeat}
+	comfort := &Rule{ID: "comfort", TargetTemp: 21, Kind: RuleKindHeat}
+	ecoFirst := &Rule{ID: "eco-first", TargetTemp: 17, Priority: 1, Kind: RuleKindHeat}
+	night := &Rule{ID: "night", Kind: RuleKindInhibit}
+	legacy := &Rule{ID: "legacy", TargetTemp: 19} // Stored before kinds, heats
+	boost := &Rule{ID: "boost", TargetTemp: 22, Priority: 2, Kind: RuleKindHeat}
+
+	testCases := []struct {
+		name  string
+		rules []*Rule
+		want  *Rule
+	}{
+		{"None", nil, nil},
+		{"Higher target at the same priority", []*Rule{eco, comfort}, comfort},
+		{"Higher priority caps a higher target", []*Rule{comfort, ecoFirst}, ecoFirst},
+		{"Inhibit wins at the same priority", []*Rule{comfort, night, legacy}, night},
+		{"Higher priority beats inhibit", []*Rule{night, boost}, boost},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := RuleInControl(tc.rules)
+			if got != tc.want {
+				t.Fatalf("Expected %v in control but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRuleWarnings(t *testing.T) {
+	now := time.Date(2024, 1, 8, 12, 0, 0, 0, time.Local) // Monday
+	night := &Rule{
+		ID:         "night",
+		Start:      time.Date(2024, 1, 1, 23, 0, 0, 0, time.Local),
+		Duration:   6 * time.Hour,
+		RepeatDays: []int{0, 1, 2, 3, 4, 5, 6},
+		Kind:       RuleKindInhibit,
+	}
+	// Tuesday late evening, runs past 23:00
+	evening := &Rule{
+		ID:         "evening",
+		Start:      time.Date(2024, 1, 1, 22, 0, 0, 0, time.Local),
+		Duration:   2 * time.Hour,
+		TargetTemp: 20,
+		RepeatDays: []int{int(time.Tuesday)},
+		Kind:       RuleKindHeat,
+	}
+	// Once, on Wednesday afternoon
+	afternoon := &Rule{
+		ID:         "afternoon",
+		Start:      time.Date(2024, 1, 10, 15, 0, 0, 0, time.Local),
+		Duration:   time.Hour,
+		TargetTemp: 20,
+		Kind:       RuleKindHeat,
+	}
+	rules := []*Rule{night, evening, afternoon}
+
+	testCases := []struct {
+		rule *Rule
+		want []string
+	}{
+		{night, []string{"overlaps rule evening, which this rule takes over"}},
+		{evening, []string{"overlaps rule night, which inhibits heating at the same priority"}},
+		{afternoon, []string{}},
+	}
+	for _, tc := range testCases {
+		got := RuleWarnings(tc.rule, rules, now)
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Fatalf("%s: wanted %v but got %v", tc.rule.ID, tc.want, got)
+		}
+	}
+
+	// Nothing left to overlap once a one off rule is over
+	if got := RuleWarnings(afternoon, []*Rule{afternoon, {ID: "past", Start: now.Add(-48 * time.Hour), Duration: time.Hour}}, now); len(got) != 0 {
+		t.Fatalf("Expected no warnings but got %v", got)
+	}
+}
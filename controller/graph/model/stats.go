@@ -0,0 +1,191 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	DEFAULT_BURNER_EFFICIENCY = 0.9   // Share of the gas energy turned into heat
+	GAS_KWH_PER_CUBIC_METER   = 10.69 // Natural gas, higher heating value
+)
+
+// Heat the burner delivers and how much gas it takes. Zero PowerKW disables
+// the gas estimate.
+type BurnerConfig struct {
+	PowerKW             float64 // Heat output while ON
+	Efficiency          float64 // Between 0 and 1, zero falls back to DEFAULT_BURNER_EFFICIENCY
+	GasKWhPerCubicMeter float64 // Zero falls back to GAS_KWH_PER_CUBIC_METER
+}
+
+// Gas burnt running for the given time, in kWh and cubic meters. Nil when
+// the burner power is unknown.
+func (b BurnerConfig) gas(on time.Duration) (*float64, *float64) {
+	if b.PowerKW <= 0 {
+		return nil, nil
+	}
+	efficiency := b.Efficiency
+	if efficiency <= 0 {
+		efficiency = DEFAULT_BURNER_EFFICIENCY
+	}
+	kWhPerCubicMeter := b.GasKWhPerCubicMeter
+	if kWhPerCubicMeter <= 0 {
+		kWhPerCubicMeter = GAS_KWH_PER_CUBIC_METER
+	}
+	kWh := b.PowerKW * on.Hours() / efficiency
+	cubicMeters := kWh / kWhPerCubicMeter
+	return &kWh, &cubicMeters
+}
+
+// Every time the burner was ON between from and to, cut at both ends. A
+// session still running at to is ongoing.
+func heatingSessions(samples []*SwitchSample, from time.Time, to time.Time) []*HeatingSession {
+	sessions := []*HeatingSession{}
+	var start *time.Time
+	closeSession := func(end time.Time, ongoing bool) {
+		if start != nil && end.After(*start) {
+			sessions = append(sessions, &HeatingSession{
+				Start:   *start,
+				End:     end,
+				Minutes: end.Sub(*start).Minutes(),
+				Ongoing: ongoing,
+			})
+		}
+		start = nil
+	}
+	for _, sample := range samples {
+		if !sample.Time.Before(to) {
+			break
+		}
+		switch {
+		case sample.State == StateOn && start == nil:
+			sessionStart := sample.Time
+			if sessionStart.Before(from) {
+				sessionStart = from // Started before the interval
+			}
+			start = &sessionStart
+		case sample.State != StateOn && start != nil:
+			closeSession(sample.Time, false)
+		}
+	}
+	closeSession(to, true)
+	return sessions
+}
+
+// Start of the bucket holding t, on the wall clock of location. Weeks start on
+// Monday.
+func bucketStart(t time.Time, bucket StatsBucket, location *time.Location) time.Time {
+	t = t.In(location)
+	year, month, day := t.Date()
+	switch bucket {
+	case StatsBucketHour:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, location)
+	case StatsBucketWeek:
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, location)
+	case StatsBucketMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, location)
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, location)
+	}
+}
+
+func nextBucket(start time.Time, bucket StatsBucket) time.Time {
+	switch bucket {
+	case StatsBucketHour:
+		return start.Add(time.Hour)
+	case StatsBucketWeek:
+		return start.AddDate(0, 0, 7)
+	case StatsBucketMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// Sessions summed up per bucket, the first and last buckets cut at from and
+// to. A session counts in the bucket it starts in, while its ON time is split
+// among the buckets it spans.
+func heatingStats(sessions []*HeatingSession, from time.Time, to time.Time, bucket StatsBucket, location *time.Location, burner BurnerConfig) []*HeatingStats {
+	stats := []*HeatingStats{}
+	if !to.After(from) {
+		return stats
+	}
+	for start := bucketStart(from, bucket, location); start.Before(to); start = nextBucket(start, bucket) {
+		end := nextBucket(start, bucket)
+		bucketFrom, bucketTo := maxTime(start, from), minTime(end, to)
+		// No time to compute a duty cycle on
+		if !bucketTo.After(bucketFrom) {
+			continue
+		}
+		var on, started time.Duration
+		count := 0
+		for _, session := range sessions {
+			overlapFrom, overlapTo := maxTime(session.Start, bucketFrom), minTime(session.End, bucketTo)
+			if overlapTo.After(overlapFrom) {
+				on += overlapTo.Sub(overlapFrom)
+			}
+			if !session.Start.Before(bucketFrom) && session.Start.Before(bucketTo) {
+				count++
+				started += session.End.Sub(session.Start)
+			}
+		}
+		stat := &HeatingStats{
+			Start:     bucketFrom,
+			End:       bucketTo,
+			OnMinutes: on.Minutes(),
+			Sessions:  count,
+			DutyCycle: on.Seconds() / bucketTo.Sub(bucketFrom).Seconds(),
+		}
+		if count > 0 {
+			stat.AverageSessionMinutes = started.Minutes() / float64(count)
+		}
+		stat.GasKWh, stat.GasCubicMeters = burner.gas(on)
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+func minTime(a time.Time, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// Nothing is known about the future, to is never after now
+func (c *Boiler) GetHeatingSessions(ctx context.Context, from time.Time, to time.Time) ([]*HeatingSession, error) {
+	to = minTime(to, time.Now())
+	if !to.After(from) {
+		return []*HeatingSession{}, nil
+	}
+	samples, err := c.GetSwitchHistory(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sessions := heatingSessions(samples, from, to)
+	for _, session := range sessions {
+		session.GasKWh, session.GasCubicMeters = c.Config.Burner.gas(session.End.Sub(session.Start))
+	}
+	return sessions, nil
+}
+
+// Buckets are aligned on the home timezone
+func (c *Boiler) GetHeatingStats(ctx context.Context, from time.Time, to time.Time, bucket StatsBucket) ([]*HeatingStats, error) {
+	if !bucket.IsValid() {
+		return nil, fmt.Errorf("unknown stats bucket: %s", bucket)
+	}
+	to = minTime(to, time.Now())
+	sessions, err := c.GetHeatingSessions(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return heatingStats(sessions, from, to, bucket, c.location(), c.Config.Burner), nil
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHeatingSessions(t *testing.T) {
+	t0 := time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int, state State) *SwitchSample {
+		return &SwitchSample{Time: t0.Add(time.Duration(minutes) * time.Minute), State: state}
+	}
+	// Starts ON from before the interval, repeated samples don't split sessions
+	samples := []*SwitchSample{
+		at(-30, StateOn),
+		at(10, StateOff),
+		at(20, StateOn),
+		at(25, StateOn),
+		at(40, StateUnknown),
+		at(50, StateOn),
+	}
+	sessions := heatingSessions(samples, t0, t0.Add(time.Hour))
+	want := []struct {
+		start, minutes float64
+		ongoing        bool
+	}{
+		{0, 10, false},
+		{20, 20, false},
+		{50, 10, true},
+	}
+	if len(sessions) != len(want) {
+		t.Fatalf("Expected %d sessions but got %d", len(want), len(sessions))
+	}
+	for i, session := range sessions {
+		if session.Start.Sub(t0).Minutes() != want[i].start || session.Minutes != want[i].minutes || session.Ongoing != want[i].ongoing {
+			t.Fatalf("Expected session %d at %v for %v minutes (ongoing %v) but got %v", i, want[i].start, want[i].minutes, want[i].ongoing, session)
+		}
+	}
+}
+
+func TestHeatingStats(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Monday the 8th of January 2024, one session across midnight
+	sessions := []*HeatingSession{
+		{Start: time.Date(2024, 1, 8, 6, 0, 0, 0, rome), End: time.Date(2024, 1, 8, 7, 0, 0, 0, rome)},
+		{Start: time.Date(2024, 1, 8, 23, 0, 0, 0, rome), End: time.Date(2024, 1, 9, 1, 0, 0, 0, rome)},
+	}
+	from := time.Date(2024, 1, 8, 0, 0, 0, 0, rome)
+	burner := BurnerConfig{PowerKW: 9, Efficiency: 0.9, GasKWhPerCubicMeter: 10}
+
+	testCases := []struct {
+		name         string
+		to           time.Time
+		bucket       StatsBucket
+		wantBuckets  int
+		wantMinutes  float64
+		wantSessions int
+		wantAverage  float64
+		wantDuty     float64
+	}{
+		{"Days", from.AddDate(0, 0, 2), StatsBucketDay, 2, 120, 2, 90, 2.0 / 24},
+		{"Hours", from.Add(7 * time.Hour), StatsBucketHour, 7, 0, 0, 0, 0},
+		{"Week starts on Monday", from.AddDate(0, 0, 2), StatsBucketWeek, 1, 180, 2, 90, 3.0 / 48},
+		{"Month cut at to", from.AddDate(0, 0, 2), StatsBucketMonth, 1, 180, 2, 90, 3.0 / 48},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := heatingStats(sessions, from, tc.to, tc.bucket, rome, burner)
+			if len(stats) != tc.wantBuckets {
+				t.Fatalf("Expected %d buckets but got %d", tc.wantBuckets, len(stats))
+			}
+			first := stats[0]
+			if !first.Start.Equal(from) {
+				t.Fatalf("Expected the first bucket to start at %s but got %s", from, first.Start)
+			}
+			if first.OnMinutes != tc.wantMinutes || first.Sessions != tc.wantSessions || first.AverageSessionMinutes != tc.wantAverage {
+				t.Fatalf("Expected %v minutes in %d sessions of %v but got %v", tc.wantMinutes, tc.wantSessions, tc.wantAverage, first)
+			}
+			if math.Abs(first.DutyCycle-tc.wantDuty) > 1e-9 {
+				t.Fatalf("Expected duty cycle %v but got %v", tc.wantDuty, first.DutyCycle)
+			}
+			// 9kW for an hour at 90% burns 10kWh, 1 cubic meter
+			if wantGas := tc.wantMinutes / 60; math.Abs(*first.GasCubicMeters-wantGas) > 1e-9 {
+				t.Fatalf("Expected %v cubic meters of gas but got %v", wantGas, *first.GasCubicMeters)
+			}
+		})
+	}
+
+	if stats := heatingStats(sessions, from, from.AddDate(0, 0, 1), StatsBucketDay, rome, BurnerConfig{}); stats[0].GasKWh != nil {
+		t.Fatalf("Expected no gas estimate without the burner power but got %v", *stats[0].GasKWh)
+	}
+	// Empty or reversed ranges have no buckets, not a NaN duty cycle
+	halfPast := from.Add(30 * time.Minute)
+	for _, to := range []time.Time{halfPast, from} {
+		if stats := heatingStats(sessions, halfPast, to, StatsBucketHour, rome, burner); len(stats) != 0 {
+			t.Fatalf("Expected no buckets up to %s but got %v", to, stats)
+		}
+	}
+}
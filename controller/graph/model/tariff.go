@@ -0,0 +1,140 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// What the tariff prices are for
+const (
+	TARIFF_UNIT_KWH = "kWh" // A kWh of gas, or of electricity for an electric heater with efficiency 1
+	TARIFF_UNIT_SMC = "Smc" // A standard cubic meter of gas
+)
+
+// Gas or electricity prices. Zero values mean free and no budget.
+type TariffConfig struct {
+	Unit          string  // TARIFF_UNIT_KWH (default) or TARIFF_UNIT_SMC
+	Price         float64 // Per Unit, outside of the bands
+	Bands         []TariffBand
+	MonthlyFee    float64 // Fixed, whatever the usage
+	MonthlyBudget float64 // Zero means no budget
+}
+
+// Time of use price, the first band matching wins
+type TariffBand struct {
+	Days  []int   // Weekdays like Rule.RepeatDays, every day when empty
+	From  string  // Wall clock in the home timezone, like "08:00"
+	To    string  // Earlier than From for bands across midnight
+	Price float64 // Per Unit
+}
+
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day '%s', like 08:00 is expected", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (t *TariffConfig) Validate() error {
+	if t.Unit != "" && t.Unit != TARIFF_UNIT_KWH && t.Unit != TARIFF_UNIT_SMC {
+		return fmt.Errorf("unknown tariff unit: %s", t.Unit)
+	}
+	if t.Price < 0 || t.MonthlyFee < 0 || t.MonthlyBudget < 0 {
+		return fmt.Errorf("tariff prices, fee and budget cannot be negative")
+	}
+	for _, band := range t.Bands {
+		from, err := parseTimeOfDay(band.From)
+		if err != nil {
+			return err
+		}
+		to, err := parseTimeOfDay(band.To)
+		if err != nil {
+			return err
+		}
+		if from == to {
+			return fmt.Errorf("tariff band from %s to %s is empty", band.From, band.To)
+		}
+		if band.Price < 0 {
+			return fmt.Errorf("tariff prices, fee and budget cannot be negative")
+		}
+		for _, day := range band.Days {
+			if day < 0 || day > 6 {
+				return fmt.Errorf("invalid tariff band day %d", day)
+			}
+		}
+	}
+	return nil
+}
+
+// Price at t, days and times of the bands are read on the wall clock of location
+func (t *TariffConfig) priceAt(at time.Time, location *time.Location) float64 {
+	wall := at.In(location)
+	minute := wall.Hour()*60 + wall.Minute()
+	for _, band := range t.Bands {
+		if len(band.Days) > 0 && !slices.Contains(band.Days, int(wall.Weekday())) {
+			continue
+		}
+		from, errFrom := parseTimeOfDay(band.From)
+		to, errTo := parseTimeOfDay(band.To)
+		if errFrom != nil || errTo != nil {
+			continue
+		}
+		if from < to && minute >= from && minute < to || from > to && (minute >= from || minute < to) {
+			return band.Price
+		}
+	}
+	return t.Price
+}
+
+// The first time after at the price may change: a band edge later in the
+// day, or midnight since bands may depend on the day
+func (t *TariffConfig) nextPriceChange(at time.Time, location *time.Location) time.Time {
+	year, month, day := at.In(location).Date()
+	next := time.Date(year, month, day+1, 0, 0, 0, 0, location)
+	for _, band := range t.Bands {
+		for _, edge := range []string{band.From, band.To} {
+			minute, err := parseTimeOfDay(edge)
+			if err != nil {
+				continue
+			}
+			candidate := time.Date(year, month, day, minute/60, minute%60, 0, 0, location)
+			if candidate.After(at) && candidate.Before(next) {
+				next = candidate
+			}
+		}
+	}
+	return next
+}
+
+// Cost of running the burner from start to end, priced at the band of every
+// moment. Nil when the gas can't be estimated.
+func (t *TariffConfig) energyCost(start time.Time, end time.Time, burner BurnerConfig, location *time.Location) *float64 {
+	if burner.PowerKW <= 0 {
+		return nil
+	}
+	cost := 0.0
+	for from := start; from.Before(end); {
+		to := minTime(t.nextPriceChange(from, location), end)
+		kWh, cubicMeters := burner.gas(to.Sub(from))
+		units := *kWh
+		if t.Unit == TARIFF_UNIT_SMC {
+			units = *cubicMeters
+		}
+		cost += units * t.priceAt(from, location)
+		from = to
+	}
+	return &cost
+}
+
+// Share of the monthly fee falling between from and to
+func (t *TariffConfig) fixedCost(from time.Time, to time.Time, location *time.Location) float64 {
+	cost := 0.0
+	for start := bucketStart(from, StatsBucketMonth, location); start.Before(to); start = nextBucket(start, StatsBucketMonth) {
+		end := nextBucket(start, StatsBucketMonth)
+		covered := minTime(end, to).Sub(maxTime(start, from))
+		cost += t.MonthlyFee * covered.Seconds() / end.Sub(start).Seconds()
+	}
+	return cost
+}
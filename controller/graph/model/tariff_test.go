@@ -0,0 +1,98 @@
+package model
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTariffPrices(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Peak on weekday mornings, cheap at night
+	tariff := TariffConfig{
+		Price: 0.10,
+		Bands: []TariffBand{
+			{Days: []int{1, 2, 3, 4, 5}, From: "08:00", To: "19:00", Price: 0.20},
+			{From: "23:00", To: "07:00", Price: 0.05},
+		},
+	}
+	// Monday the 8th of January 2024
+	monday := func(hour, minute int) time.Time { return time.Date(2024, 1, 8, hour, minute, 0, 0, rome) }
+	testCases := []struct {
+		name string
+		at   time.Time
+		want float64
+	}{
+		{"Outside of the bands", monday(7, 30), 0.10},
+		{"Peak", monday(8, 0), 0.20},
+		{"Peak ends", monday(19, 0), 0.10},
+		{"Peak only on weekdays", monday(10, 0).AddDate(0, 0, 5), 0.10},
+		{"Night before midnight", monday(23, 30), 0.05},
+		{"Night after midnight", monday(6, 59), 0.05},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if price := tariff.priceAt(tc.at, rome); price != tc.want {
+				t.Fatalf("Expected %v but got %v", tc.want, price)
+			}
+		})
+	}
+
+	// 9kW at 90% burns 10kWh an hour, half of it before the peak and half in it
+	burner := BurnerConfig{PowerKW: 9, Efficiency: 0.9, GasKWhPerCubicMeter: 10}
+	cost := tariff.energyCost(monday(7, 30), monday(8, 30), burner, rome)
+	if cost == nil || math.Abs(*cost-(5*0.10+5*0.20)) > 1e-9 {
+		t.Fatalf("Expected the cost split across the band edge but got %v", cost)
+	}
+	tariff.Unit = TARIFF_UNIT_SMC
+	cost = tariff.energyCost(monday(23, 0), monday(23, 30), burner, rome)
+	if cost == nil || math.Abs(*cost-0.5*0.05) > 1e-9 {
+		t.Fatalf("Expected half a cubic meter at the night price but got %v", cost)
+	}
+	if cost := tariff.energyCost(monday(8, 0), monday(9, 0), BurnerConfig{}, rome); cost != nil {
+		t.Fatalf("Expected no cost without the burner power but got %v", *cost)
+	}
+}
+
+func TestTariffFixedCost(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tariff := TariffConfig{MonthlyFee: 31}
+	// A whole day of January, and the last day of January with the first of February
+	day := tariff.fixedCost(time.Date(2024, 1, 8, 0, 0, 0, 0, rome), time.Date(2024, 1, 9, 0, 0, 0, 0, rome), rome)
+	if math.Abs(day-1) > 1e-9 {
+		t.Fatalf("Expected a thirty-first of the fee but got %v", day)
+	}
+	days := tariff.fixedCost(time.Date(2024, 1, 31, 0, 0, 0, 0, rome), time.Date(2024, 2, 2, 0, 0, 0, 0, rome), rome)
+	if want := 1 + 31.0/29; math.Abs(days-want) > 1e-9 {
+		t.Fatalf("Expected %v but got %v", want, days)
+	}
+}
+
+func TestTariffValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		tariff  TariffConfig
+		wantErr bool
+	}{
+		{"Empty", TariffConfig{}, false},
+		{"Bands", TariffConfig{Unit: TARIFF_UNIT_SMC, Bands: []TariffBand{{Days: []int{0, 6}, From: "22:00", To: "06:00", Price: 1}}}, false},
+		{"Unknown unit", TariffConfig{Unit: "therm"}, true},
+		{"Negative price", TariffConfig{Price: -1}, true},
+		{"Bad time of day", TariffConfig{Bands: []TariffBand{{From: "8", To: "19:00"}}}, true},
+		{"Empty band", TariffConfig{Bands: []TariffBand{{From: "08:00", To: "08:00"}}}, true},
+		{"Bad day", TariffConfig{Bands: []TariffBand{{Days: []int{7}, From: "08:00", To: "19:00"}}}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.tariff.Validate(); (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v but got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
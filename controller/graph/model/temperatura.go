@@ -6,54 +6,62 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/redis/go-redis/v9"
+	"stupid-caldaia/controller/storage"
 )
 
 const (
 	PrimaryRetentionTime = 7 * 24 * 60 * 60 * 1000 // 7 days
 	CompactTime          = 5 * 60 * 1000           // 5 minutes
+	DefaultStaleAfter    = 5 * time.Minute
+	sampleRatePeriod     = time.Hour
 )
 
 type SensorOptions struct {
-	Name     string
-	Position string
+	Name              string
+	Position          string
+	StaleAfterSeconds float64 // Silence after which the sensor can't be trusted, default DefaultStaleAfter
 }
 
 type Sensor struct {
 	Name         string
 	Position     string
-	Client       *redis.Client
+	Client       storage.Storage
 	Id           string
+	StaleAfter   time.Duration
 	compactedKey string
 }
 
-func NewSensor(ctx context.Context, client *redis.Client, opt *SensorOptions) (*Sensor, error) {
+func NewSensor(ctx context.Context, client storage.Storage, opt *SensorOptions) (*Sensor, error) {
 	key := opt.Name + ":" + opt.Position
 	compactedKey := opt.Name + "_compacted" + ":" + opt.Position
-	sensor := Sensor{opt.Name, opt.Position, client, key, compactedKey}
+	staleAfter := time.Duration(opt.StaleAfterSeconds * float64(time.Second))
+	if staleAfter <= 0 {
+		staleAfter = DefaultStaleAfter
+	}
+	sensor := Sensor{opt.Name, opt.Position, client, key, staleAfter, compactedKey}
 
 	// Check if sensor already exists
-	exists, _ := sensor.Client.Exists(ctx, key).Result()
-	if exists == 0 {
+	exists, _ := sensor.Client.Exists(ctx, key)
+	if !exists {
 		// If not, create it
-		_, err := sensor.Client.TSCreateWithArgs(ctx, key, &redis.TSOptions{
+		err := sensor.Client.TSCreate(ctx, key, &storage.SeriesOptions{
 			Retention: PrimaryRetentionTime,
 			Labels:    map[string]string{"position": sensor.Position},
-		}).Result()
+		})
 		if err != nil {
 			return &sensor, err
 		}
 	}
-	exists, _ = sensor.Client.Exists(ctx, compactedKey).Result()
-	if exists == 0 {
+	exists, _ = sensor.Client.Exists(ctx, compactedKey)
+	if !exists {
 		// Create compaction key
-		_, err := sensor.Client.TSCreateWithArgs(ctx, compactedKey, &redis.TSOptions{Retention: 0}).Result()
+		err := sensor.Client.TSCreate(ctx, compactedKey, &storage.SeriesOptions{Retention: 0})
 		if err != nil {
 			return &sensor, err
 		}
 
 		// Create compaction rule
-		_, err = sensor.Client.TSCreateRule(ctx, key, compactedKey, redis.Avg, CompactTime).Result()
+		err = sensor.Client.TSCreateRule(ctx, key, compactedKey, storage.Avg, CompactTime)
 		if err != nil {
 			return &sensor, err
 		}
@@ -65,10 +73,8 @@ func NewSensor(ctx context.Context, client *redis.Client, opt *SensorOptions) (*
 // If from is nil, it will be set to 24 hours before to.
 // If to is nil, it will be set to the current time.
 func (s *Sensor) Get(ctx context.Context, from time.Time, to time.Time) ([]*Measure, error) {
-	// Get data from Redis
-	fromTimestamp := int(from.UnixMilli())
-	toTimestamp := int(to.UnixMilli())
-	data, err := s.Client.TSRange(ctx, s.compactedKey, fromTimestamp, toTimestamp).Result()
+	// Get data from storage
+	data, err := s.Client.TSRange(ctx, s.compactedKey, from.UnixMilli(), to.UnixMilli())
 	if err != nil {
 		return nil, err
 	}
@@ -76,33 +82,68 @@ func (s *Sensor) Get(ctx context.Context, from time.Time, to time.Time) ([]*Meas
 	// Parse data
 	measures := make([]*Measure, len(data))
 	for index, sample := range data {
-		measures[index] = &Measure{sample.Value, time.UnixMilli(int64(sample.Timestamp))}
+		measures[index] = &Measure{sample.Value, time.UnixMilli(sample.Timestamp)}
 	}
 	return measures, nil
 }
 
+// Latest raw sample, nil if there is none
+func (s *Sensor) GetLatest(ctx context.Context) (*Measure, error) {
+	data, err := s.Client.TSRevRange(ctx, s.Id, 0, time.Now().UnixMilli(), 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return &Measure{data[0].Value, time.UnixMilli(data[0].Timestamp)}, nil
+}
+
+// A sensor without samples or silent for longer than StaleAfter
+func (s *Sensor) IsStale(latest *Measure, now time.Time) bool {
+	return latest == nil || now.Sub(latest.Time) > s.StaleAfter
+}
+
+func (s *Sensor) Health(ctx context.Context, now time.Time) (*SensorHealth, error) {
+	latest, err := s.GetLatest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := s.Client.TSRange(ctx, s.Id, now.Add(-sampleRatePeriod).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	health := &SensorHealth{
+		ID:               s.Id,
+		IsStale:          s.IsStale(latest, now),
+		SamplesPerMinute: float64(len(samples)) / sampleRatePeriod.Minutes(),
+	}
+	if latest != nil {
+		health.LastSeen = &latest.Time
+	}
+	return health, nil
+}
+
 func (s *Sensor) Listen(ctx context.Context) (<-chan *Measure, error) {
 	fmt.Println("Listening for updates on sensor", s.Id)
+	messages, err := s.Client.Subscribe(ctx, s.Id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to temperature PubSub: %w", err)
+	}
 	temperatureUpdates := make(chan *Measure)
 	go func() {
 		defer close(temperatureUpdates)
-		sub := s.Client.Subscribe(ctx, s.Id)
-		defer sub.Close()
-
-		if _, err := sub.Receive(ctx); err != nil {
-			fmt.Printf("failed to receive from temperature PubSub: %s", err)
-			return
-		}
-
-		redisChannel := sub.Channel()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case msg := <-redisChannel:
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
 				// Attempt to unmarshal the payload into a Measure
 				measure := &Measure{}
-				err := json.Unmarshal([]byte(msg.Payload), measure)
+				err := json.Unmarshal(msg, measure)
 				if err != nil {
 					fmt.Println("Error unmarshalling payload:", err)
 					continue
@@ -121,8 +162,8 @@ func (s *Sensor) Listen(ctx context.Context) (<-chan *Measure, error) {
 }
 
 func (s *Sensor) AddSample(ctx context.Context, sample *Measure) error {
-	// Add sample to Redis
-	_, err := s.Client.TSAdd(ctx, s.Id, int(sample.Time.UnixMilli()), sample.Value).Result()
+	// Add sample to storage
+	err := s.Client.TSAdd(ctx, s.Id, sample.Time.UnixMilli(), sample.Value)
 	if err != nil {
 		return err
 	}
@@ -132,7 +173,7 @@ func (s *Sensor) AddSample(ctx context.Context, sample *Measure) error {
 	if err != nil {
 		return err
 	}
-	return s.Client.Publish(ctx, s.Id, message).Err()
+	return s.Client.Publish(ctx, s.Id, message)
 }
 
 func (s *Sensor) GetAverage(ctx context.Context, from time.Time, to time.Time) (*float64, error) {
@@ -0,0 +1,57 @@
+package model_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/testutils"
+)
+
+func TestSensorHealth(t *testing.T) {
+	ctx := context.Background()
+	client := testutils.CreateTestStorage()
+	position := "test_" + t.Name()
+	err := client.Del(ctx, "temperatura:"+position, "temperatura_compacted:"+position)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor, err := model.NewSensor(ctx, client, &model.SensorOptions{Name: "temperatura", Position: position, StaleAfterSeconds: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	health, err := sensor.Health(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !health.IsStale || health.LastSeen != nil {
+		t.Fatalf("Expected a sensor never heard to be stale but got %+v", health)
+	}
+
+	// A sample every 10 seconds for half an hour
+	for i := 180; i > 0; i-- {
+		err = sensor.AddSample(ctx, &model.Measure{Value: 20, Time: now.Add(-time.Duration(i) * 10 * time.Second)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	health, err = sensor.Health(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.IsStale || health.LastSeen == nil || health.SamplesPerMinute != 3 {
+		t.Fatalf("Expected a healthy sensor with 3 samples per minute but got %+v", health)
+	}
+
+	// Silent for longer than allowed
+	health, err = sensor.Health(ctx, now.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !health.IsStale {
+		t.Fatal("Expected the sensor to be stale after 2 minutes of silence")
+	}
+}
@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// Rule times are worked out on the wall clock of the home timezone, so a
+// 07:00 rule stays at 07:00 across DST changes. Wall clock readings are kept
+// as UTC times with the same fields, which never skip or repeat, and placed
+// back in the home timezone only at the end.
+
+// The reading of the wall clock at t, in the location of t
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// When the wall clock of location reads wall. A reading skipped when the
+// clocks go forward is the moment they do, a reading repeated when they go
+// back is its first occurrence.
+func atWallClock(wall time.Time, location *time.Location) time.Time {
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), location)
+	zoneStart, zoneEnd := t.ZoneBounds()
+	if reading := wallClock(t); !reading.Equal(wall) {
+		// Skipped, moved to either side of the gap
+		if reading.After(wall) {
+			return zoneStart
+		}
+		return zoneEnd
+	}
+	if zoneStart.IsZero() {
+		return t
+	}
+	// Repeated if the zone before reads the same a bit earlier
+	_, offsetBefore := zoneStart.Add(-time.Nanosecond).Zone()
+	earlier := wall.Add(-time.Duration(offsetBefore) * time.Second).In(location)
+	if earlier.Before(zoneStart) && wallClock(earlier).Equal(wall) {
+		return earlier
+	}
+	return t
+}
+
+// The home timezone of the boiler, the local one when not configured
+func (c *Boiler) location() *time.Location {
+	if c.Config.Location != nil {
+		return c.Config.Location
+	}
+	return time.Local
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+// In 2024 Europe/Rome skips from 02:00 to 03:00 on the 31st of March and
+// repeats 02:00 to 03:00 on the 27th of October
+func loadRome(t *testing.T) *time.Location {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rome
+}
+
+func TestAtWallClock(t *testing.T) {
+	rome := loadRome(t)
+	testCases := []struct {
+		name string
+		wall time.Time
+		want time.Time
+	}{
+		{"Winter", time.Date(2024, 1, 8, 7, 0, 0, 0, time.UTC), time.Date(2024, 1, 8, 6, 0, 0, 0, time.UTC)},
+		{"Summer", time.Date(2024, 7, 8, 7, 0, 0, 0, time.UTC), time.Date(2024, 7, 8, 5, 0, 0, 0, time.UTC)},
+		{"Skipped hour starts when the clocks go forward", time.Date(2024, 3, 31, 2, 30, 0, 0, time.UTC), time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC)},
+		{"Right after the skipped hour", time.Date(2024, 3, 31, 3, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC)},
+		{"Repeated hour is its first occurrence", time.Date(2024, 10, 27, 2, 30, 0, 0, time.UTC), time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC)},
+		{"Right after the repeated hour", time.Date(2024, 10, 27, 3, 0, 0, 0, time.UTC), time.Date(2024, 10, 27, 2, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := atWallClock(tc.wall, rome)
+			if !got.Equal(tc.want) {
+				t.Fatalf("Expected %s but got %s", tc.want, got.UTC())
+			}
+		})
+	}
+}
+
+func TestWindowsAcrossDST(t *testing.T) {
+	rome := loadRome(t)
+	everyDay := []int{0, 1, 2, 3, 4, 5, 6}
+	// Sent in winter with a bare offset, read back in the home timezone
+	morning := &Rule{Start: time.Date(2024, 1, 8, 7, 0, 0, 0, time.FixedZone("", 3600)).In(rome), Duration: time.Hour, RepeatDays: everyDay}
+	// Starts in the hour that is skipped in spring and repeated in autumn
+	early := &Rule{Start: time.Date(2024, 1, 8, 2, 30, 0, 0, rome), Duration: time.Hour, RepeatDays: everyDay}
+	night := &Rule{Start: time.Date(2024, 1, 8, 22, 0, 0, 0, rome), Duration: 8 * time.Hour, RepeatDays: everyDay}
+	everyNight := "30 2 * * *"
+	earlyCron := &Rule{Start: time.Date(2024, 1, 1, 0, 0, 0, 0, rome), Duration: time.Hour, Cron: &everyNight}
+	daily := "FREQ=DAILY"
+	morningRrule := &Rule{Start: time.Date(2024, 1, 8, 7, 0, 0, 0, rome), Duration: time.Hour, Rrule: &daily}
+
+	testCases := []struct {
+		name      string
+		rule      *Rule
+		now       time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "Same time of day after going forward",
+			rule:      morning,
+			now:       time.Date(2024, 3, 31, 6, 0, 0, 0, rome),
+			wantStart: time.Date(2024, 3, 31, 7, 0, 0, 0, rome),
+			wantEnd:   time.Date(2024, 3, 31, 8, 0, 0, 0, rome),
+		},
+		{
+			name:      "Same time of day after going back",
+			rule:      morning,
+			now:       time.Date(2024, 10, 27, 6, 0, 0, 0, rome),
+			wantStart: time.Date(2024, 10, 27, 7, 0, 0, 0, rome),
+			wantEnd:   time.Date(2024, 10, 27, 8, 0, 0, 0, rome),
+		},
+		{
+			name:      "Skipped start is when the clocks go forward, for the whole duration",
+			rule:      early,
+			now:       time.Date(2024, 3, 31, 1, 0, 0, 0, rome),
+			wantStart: time.Date(2024, 3, 31, 3, 0, 0, 0, rome),
+			wantEnd:   time.Date(2024, 3, 31, 4, 0, 0, 0, rome),
+		},
+		{
+			name:      "Repeated start is the first one",
+			rule:      early,
+			now:       time.Date(2024, 10, 27, 1, 0, 0, 0, rome),
+			wantStart: time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 10, 27, 3, 30, 0, 0, rome),
+		},
+		{
+			name:      "Night shortened by the skipped hour still ends at 06:00",
+			rule:      night,
+			now:       time.Date(2024, 3, 30, 21, 0, 0, 0, rome),
+			wantStart: time.Date(2024, 3, 30, 22, 0, 0, 0, rome),
+			wantEnd:   time.Date(2024, 3, 31, 6, 0, 0, 0, rome),
+		},
+		{
+			name:      "Night lengthened by the repeated hour still ends at 06:00",
+			rule:      night,
+			now:       time.Date(2024, 10, 26, 21, 0, 0, 0, rome),
+			wantStart: time.Date(2024, 10, 26, 22, 0, 0, 0, rome),
+			wantEnd:   time.Date(2024, 10, 27, 6, 0, 0, 0, rome),
+		},
+		{
+			name:      "Cron in the skipped hour isn't lost",
+			rule:      earlyCron,
+			now:       time.Date(2024, 3, 31, 1, 0, 0, 0, rome),
+			wantStart: time.Date(2024, 3, 31, 3, 0, 0, 0, rome),
+			wantEnd:   time.Date(2024, 3, 31, 4, 0, 0, 0, rome),
+		},
+		{
+			name:      "Cron in the repeated hour runs once",
+			rule:      earlyCron,
+			now:       time.Date(2024, 10, 27, 4, 0, 0, 0, rome),
+			wantStart: time.Date(2024, 10, 28, 2, 30, 0, 0, rome),
+			wantEnd:   time.Date(2024, 10, 28, 3, 30, 0, 0, rome),
+		},
+		{
+			name:      "RRULE keeps the time of day in summer",
+			rule:      morningRrule,
+			now:       time.Date(2024, 7, 8, 6, 0, 0, 0, rome),
+			wantStart: time.Date(2024, 7, 8, 7, 0, 0, 0, rome),
+			wantEnd:   time.Date(2024, 7, 8, 8, 0, 0, 0, rome),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			start := tc.rule.WindowStartTime(tc.now)
+			if !start.Equal(tc.wantStart) {
+				t.Fatalf("Expected start %s but got %s", tc.wantStart, start)
+			}
+			if end := tc.rule.windowEnd(start); !end.Equal(tc.wantEnd) {
+				t.Fatalf("Expected end %s but got %s", tc.wantEnd, end)
+			}
+			windows := tc.rule.controlWindows(tc.now, tc.wantEnd)
+			if len(windows) == 0 || !windows[len(windows)-1].start.Equal(tc.wantStart) || !windows[len(windows)-1].end.Equal(tc.wantEnd) {
+				t.Fatalf("Expected the control window from %s to %s but got %v", tc.wantStart, tc.wantEnd, windows)
+			}
+		})
+	}
+}
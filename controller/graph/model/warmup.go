@@ -0,0 +1,147 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"stupid-caldaia/controller/storage"
+)
+
+const (
+	minWarmUpSession      = 10 * time.Minute // Shorter sessions are mostly noise
+	warmUpSampleTolerance = 10 * time.Minute // How far a temperature sample can be from the session edges
+	minWarmUpRate         = 0.1              // °C per hour, anything slower means we can't estimate
+	minWarmUpSlopeSpread  = 0.5              // °C of spread in starting temperatures needed to fit a slope
+)
+
+// Warm up rate at a given starting temperature
+func (w *WarmUpRate) RateAt(temperature float64) float64 {
+	return w.Intercept + w.Slope*temperature
+}
+
+// Time needed to heat from a temperature to a target, never more than maxLead
+func (w *WarmUpRate) LeadTime(from float64, to float64, maxLead time.Duration) time.Duration {
+	if to <= from {
+		return 0
+	}
+	rate := w.RateAt(from)
+	if rate < minWarmUpRate {
+		return maxLead
+	}
+	lead := time.Duration((to - from) / rate * float64(time.Hour))
+	return min(lead, maxLead)
+}
+
+type warmUpSession struct {
+	startTemperature float64
+	rate             float64 // °C per hour
+}
+
+// Looks at every heating session in the interval and fits how fast the
+// temperature rises against the temperature we started from. Returns nil when
+// there is nothing to learn from.
+func LearnWarmUpRate(ctx context.Context, boiler *Boiler, sensor *Sensor, from time.Time, to time.Time) (*WarmUpRate, error) {
+	switchSamples, err := boiler.GetSwitchHistory(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	measures, err := sensor.Get(ctx, from.Add(-warmUpSampleTolerance), to.Add(warmUpSampleTolerance))
+	if err != nil {
+		return nil, err
+	}
+	sessions := warmUpSessions(switchTransitions(switchSamples), measures)
+	return fitWarmUpRate(sessions, to), nil
+}
+
+func warmUpSessions(transitions []*SwitchSample, measures []*Measure) []warmUpSession {
+	sessions := []warmUpSession{}
+	for i := 0; i < len(transitions)-1; i++ {
+		start, end := transitions[i], transitions[i+1]
+		if start.State != StateOn || end.State != StateOff {
+			continue
+		}
+		duration := end.Time.Sub(start.Time)
+		if duration < minWarmUpSession {
+			continue
+		}
+		startTemperature, okStart := temperatureAt(measures, start.Time)
+		endTemperature, okEnd := temperatureAt(measures, end.Time)
+		if !okStart || !okEnd || endTemperature <= startTemperature {
+			continue
+		}
+		sessions = append(sessions, warmUpSession{
+			startTemperature: startTemperature,
+			rate:             (endTemperature - startTemperature) / duration.Hours(),
+		})
+	}
+	return sessions
+}
+
+// Closest measure to the given time, if close enough
+func temperatureAt(measures []*Measure, t time.Time) (float64, bool) {
+	var closest *Measure
+	for _, measure := range measures {
+		if closest == nil || measure.Time.Sub(t).Abs() < closest.Time.Sub(t).Abs() {
+			closest = measure
+		}
+	}
+	if closest == nil || closest.Time.Sub(t).Abs() > warmUpSampleTolerance {
+		return 0, false
+	}
+	return closest.Value, true
+}
+
+// Least squares fit of rate = intercept + slope * start temperature. With too
+// little spread in the starting temperatures it's just the average rate.
+func fitWarmUpRate(sessions []warmUpSession, computedAt time.Time) *WarmUpRate {
+	count := float64(len(sessions))
+	if count == 0 {
+		return nil
+	}
+	meanTemperature, meanRate := 0.0, 0.0
+	for _, session := range sessions {
+		meanTemperature += session.startTemperature / count
+		meanRate += session.rate / count
+	}
+	covariance, variance := 0.0, 0.0
+	for _, session := range sessions {
+		covariance += (session.startTemperature - meanTemperature) * (session.rate - meanRate)
+		variance += math.Pow(session.startTemperature-meanTemperature, 2)
+	}
+
+	slope := 0.0
+	if len(sessions) >= 3 && math.Sqrt(variance/count) >= minWarmUpSlopeSpread {
+		slope = covariance / variance
+	}
+	return &WarmUpRate{
+		Intercept:  meanRate - slope*meanTemperature,
+		Slope:      slope,
+		Sessions:   len(sessions),
+		ComputedAt: computedAt,
+	}
+}
+
+func (c *Boiler) GetWarmUpRate(ctx context.Context) (*WarmUpRate, error) {
+	data, err := c.client.Get(ctx, c.warmUpKey)
+	switch err {
+	case storage.Nil: // Not learned yet
+		return nil, nil
+	case nil:
+		rate := &WarmUpRate{}
+		err = json.Unmarshal(data, rate)
+		return rate, err
+	default:
+		return nil, fmt.Errorf("could not get warm up rate: %w", err)
+	}
+}
+
+func (c *Boiler) SetWarmUpRate(ctx context.Context, rate *WarmUpRate) error {
+	data, err := json.Marshal(rate)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, c.warmUpKey, data)
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWarmUpSessions(t *testing.T) {
+	t0 := time.Date(2024, 1, 7, 6, 0, 0, 0, time.Local)
+	transitions := []*SwitchSample{
+		{Time: t0, State: StateOn},
+		{Time: t0.Add(time.Hour), State: StateOff},
+		{Time: t0.Add(2 * time.Hour), State: StateOn},
+		{Time: t0.Add(2*time.Hour + 5*time.Minute), State: StateOff}, // Too short
+		{Time: t0.Add(3 * time.Hour), State: StateOn},
+		{Time: t0.Add(4 * time.Hour), State: StateOff}, // No measures around
+	}
+	measures := []*Measure{
+		{Value: 16, Time: t0.Add(2 * time.Minute)},
+		{Value: 18, Time: t0.Add(time.Hour - 3*time.Minute)},
+		{Value: 18, Time: t0.Add(2 * time.Hour)},
+		{Value: 19, Time: t0.Add(2*time.Hour + 5*time.Minute)},
+	}
+	sessions := warmUpSessions(transitions, measures)
+	if len(sessions) != 1 {
+		t.Fatalf("Expected 1 session but got %d", len(sessions))
+	}
+	if sessions[0].startTemperature != 16 || sessions[0].rate != 2 {
+		t.Fatalf("Expected 2°C/h from 16°C but got %+v", sessions[0])
+	}
+}
+
+func TestFitWarmUpRate(t *testing.T) {
+	now := time.Now()
+	if fitWarmUpRate(nil, now) != nil {
+		t.Fatal("Expected no rate without sessions")
+	}
+
+	testCases := []struct {
+		name          string
+		sessions      []warmUpSession
+		wantIntercept float64
+		wantSlope     float64
+	}{
+		{
+			name:          "Single session",
+			sessions:      []warmUpSession{{16, 2}},
+			wantIntercept: 2,
+			wantSlope:     0,
+		},
+		{
+			name:          "Same starting temperature",
+			sessions:      []warmUpSession{{16, 1}, {16, 2}, {16.1, 3}},
+			wantIntercept: 2,
+			wantSlope:     0,
+		},
+		{
+			name:          "Slower when warmer",
+			sessions:      []warmUpSession{{14, 3}, {16, 2}, {18, 1}},
+			wantIntercept: 10,
+			wantSlope:     -0.5,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := fitWarmUpRate(tc.sessions, now)
+			if math.Abs(got.Intercept-tc.wantIntercept) > 0.001 || math.Abs(got.Slope-tc.wantSlope) > 0.001 {
+				t.Fatalf("Wanted %.2f%+.2f·T but got %.2f%+.2f·T", tc.wantIntercept, tc.wantSlope, got.Intercept, got.Slope)
+			}
+			if got.Sessions != len(tc.sessions) {
+				t.Fatalf("Wanted %d sessions but got %d", len(tc.sessions), got.Sessions)
+			}
+		})
+	}
+}
+
+func TestLeadTime(t *testing.T) {
+	rate := &WarmUpRate{Intercept: 10, Slope: -0.5}
+	testCases := []struct {
+		name string
+		from float64
+		to   float64
+		want time.Duration
+	}{
+		{name: "Already warm", from: 21, to: 20, want: 0},
+		{name: "One degree at 2°C/h", from: 16, to: 17, want: 30 * time.Minute},
+		{name: "Capped", from: 10, to: 21, want: 2 * time.Hour},
+		{name: "Can't heat", from: 20, to: 21, want: 2 * time.Hour},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := rate.LeadTime(tc.from, tc.to, 2*time.Hour)
+			if got != tc.want {
+				t.Fatalf("Wanted %s but got %s", tc.want, got)
+			}
+		})
+	}
+}
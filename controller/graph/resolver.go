@@ -1,17 +1,61 @@
 package graph
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/storage"
+	"time"
 
-	"github.com/redis/go-redis/v9"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
+const ConflictErrorCode = "CONFLICT"
+
 // This file will not be regenerated automatically.
 //
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	Boiler  *model.Boiler
-	Client  *redis.Client
-	Sensors map[string]*model.Sensor
+	Boilers       map[string]*model.Boiler
+	DefaultBoiler string // Used when a request doesn't name a boiler
+	Client        storage.Storage
+	Sensors       map[string]*model.Sensor
+}
+
+// The named boiler, or the default one when name is nil
+func (r *Resolver) boiler(name *string) (*model.Boiler, error) {
+	boilerName := r.DefaultBoiler
+	if name != nil {
+		boilerName = *name
+	}
+	boiler, ok := r.Boilers[boilerName]
+	if !ok {
+		return nil, fmt.Errorf("unknown boiler: %s", boilerName)
+	}
+	return boiler, nil
+}
+
+// Warnings are only worked out for rules a client asks for
+func rulesWithWarnings(rules []*model.Rule) []*model.Rule {
+	now := time.Now()
+	withWarnings := make([]*model.Rule, len(rules))
+	for i, rule := range rules {
+		withWarnings[i] = model.WithWarnings(rule, rules, now)
+	}
+	return withWarnings
+}
+
+// Conflicts get a code clients can match to reload and try again
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	presented := graphql.DefaultErrorPresenter(ctx, err)
+	if errors.Is(err, model.ErrConflict) {
+		if presented.Extensions == nil {
+			presented.Extensions = map[string]interface{}{}
+		}
+		presented.Extensions["code"] = ConflictErrorCode
+	}
+	return presented
 }
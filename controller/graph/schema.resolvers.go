@@ -6,68 +6,252 @@ package graph
 
 import (
 	"context"
+	"fmt"
 	"slices"
 	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/thermal"
 	"time"
 )
 
+// Rules is the resolver for the rules field.
+func (r *boilerInfoResolver) Rules(ctx context.Context, obj *model.BoilerInfo) ([]*model.Rule, error) {
+	return rulesWithWarnings(obj.Rules), nil
+}
+
+// RuleInControl is the resolver for the ruleInControl field.
+func (r *boilerInfoResolver) RuleInControl(ctx context.Context, obj *model.BoilerInfo) (*model.Rule, error) {
+	// The away and boost rules are not among the others
+	inControl := obj.RuleInControl
+	if inControl == nil || !slices.ContainsFunc(obj.Rules, func(rule *model.Rule) bool { return rule.ID == inControl.ID }) {
+		return inControl, nil
+	}
+	return model.WithWarnings(inControl, obj.Rules, time.Now()), nil
+}
+
 // UpdateBoiler is the resolver for the updateBoiler field.
-func (r *mutationResolver) UpdateBoiler(ctx context.Context, state *model.State, minTemp *float64, maxTemp *float64) (*model.BoilerInfo, error) {
+func (r *mutationResolver) UpdateBoiler(ctx context.Context, boiler *string, state *model.State, minTemp *float64, maxTemp *float64) (*model.BoilerInfo, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
 	if state != nil {
-		_, err := r.Resolver.Boiler.Switch(ctx, *state)
+		_, err := b.Switch(ctx, *state, false)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	if minTemp != nil {
-		_, err := r.Resolver.Boiler.SetMinTemp(ctx, *minTemp)
+		_, err := b.SetMinTemp(ctx, *minTemp)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	if maxTemp != nil {
-		_, err := r.Resolver.Boiler.SetMaxTemp(ctx, *maxTemp)
+		_, err := b.SetMaxTemp(ctx, *maxTemp)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	return r.Resolver.Boiler.GetInfo(ctx)
+	return b.GetInfo(ctx)
 }
 
 // SetRule is the resolver for the setRule field.
-func (r *mutationResolver) SetRule(ctx context.Context, id *string, start time.Time, duration time.Duration, delay time.Duration, targetTemp float64, repeatDays []int) (*model.Rule, error) {
+func (r *mutationResolver) SetRule(ctx context.Context, boiler *string, id *string, start time.Time, duration time.Duration, delay time.Duration, targetTemp float64, repeatDays []int, hysteresisLower *float64, hysteresisUpper *float64, priority *int, kind *model.RuleKind, cron *string, rrule *string, profile *string) (*model.Rule, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
 	slices.Sort(repeatDays)
 	opt := &model.Rule{
-		Start:      start,
-		Duration:   duration,
-		Delay:      delay,
-		TargetTemp: targetTemp,
-		RepeatDays: repeatDays,
+		Start:           start,
+		Duration:        duration,
+		Delay:           delay,
+		TargetTemp:      targetTemp,
+		RepeatDays:      repeatDays,
+		HysteresisLower: hysteresisLower,
+		HysteresisUpper: hysteresisUpper,
 	}
 	if id != nil {
 		opt.ID = *id
 	}
-	return r.Resolver.Boiler.SetRule(ctx, opt)
+	if priority != nil {
+		opt.Priority = *priority
+	}
+	if kind != nil {
+		opt.Kind = *kind
+	}
+	opt.Cron = cron
+	opt.Rrule = rrule
+	if profile != nil {
+		return b.SetProfileRule(ctx, *profile, opt)
+	}
+	return b.SetRule(ctx, opt)
 }
 
 // StopRule is the resolver for the stopRule field.
-func (r *mutationResolver) StopRule(ctx context.Context, id string) (bool, error) {
-	programmedInterval, err := r.Resolver.Boiler.StopRule(ctx, id)
+func (r *mutationResolver) StopRule(ctx context.Context, boiler *string, id string) (bool, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return false, err
+	}
+	programmedInterval, err := b.StopRule(ctx, id)
 	return !programmedInterval.IsActive, err
 }
 
 // DeleteRule is the resolver for the deleteRule field.
-func (r *mutationResolver) DeleteRule(ctx context.Context, id string) (bool, error) {
-	err := r.Resolver.Boiler.DeleteRule(ctx, id)
+func (r *mutationResolver) DeleteRule(ctx context.Context, boiler *string, id string, profile *string) (bool, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return false, err
+	}
+	if profile != nil {
+		err = b.DeleteProfileRule(ctx, *profile, id)
+	} else {
+		err = b.DeleteRule(ctx, id)
+	}
 	return err == nil, err
 }
 
+// SetOverheatingSettings is the resolver for the setOverheatingSettings field.
+func (r *mutationResolver) SetOverheatingSettings(ctx context.Context, boiler *string, tauSeconds *float64, onThreshold *float64, offThreshold *float64, checkPeriodSeconds *float64) (*model.OverheatingSettings, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	return b.UpdateOverheatingSettings(ctx, func(settings *model.OverheatingSettings) {
+		if tauSeconds != nil {
+			settings.TauSeconds = *tauSeconds
+		}
+		if onThreshold != nil {
+			settings.OnThreshold = *onThreshold
+		}
+		if offThreshold != nil {
+			settings.OffThreshold = *offThreshold
+		}
+		if checkPeriodSeconds != nil {
+			settings.CheckPeriodSeconds = *checkPeriodSeconds
+		}
+	})
+}
+
+// SetAwayMode is the resolver for the setAwayMode field.
+func (r *mutationResolver) SetAwayMode(ctx context.Context, boiler *string, start *time.Time, end time.Time, frostTemp *float64) (*model.BoilerInfo, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	awayStart := time.Now()
+	if start != nil {
+		awayStart = *start
+	}
+	awayFrostTemp := b.FrostTemperature()
+	if frostTemp != nil {
+		awayFrostTemp = *frostTemp
+	}
+	return b.SetAwayMode(ctx, awayStart, end, awayFrostTemp)
+}
+
+// CancelAwayMode is the resolver for the cancelAwayMode field.
+func (r *mutationResolver) CancelAwayMode(ctx context.Context, boiler *string) (*model.BoilerInfo, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	return b.CancelAwayMode(ctx)
+}
+
+// SetProfile is the resolver for the setProfile field.
+func (r *mutationResolver) SetProfile(ctx context.Context, boiler *string, name string, copyFrom *string) (*model.Profile, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	return b.SetProfile(ctx, name, copyFrom)
+}
+
+// DeleteProfile is the resolver for the deleteProfile field.
+func (r *mutationResolver) DeleteProfile(ctx context.Context, boiler *string, name string) (bool, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return false, err
+	}
+	err = b.DeleteProfile(ctx, name)
+	return err == nil, err
+}
+
+// ActivateProfile is the resolver for the activateProfile field.
+func (r *mutationResolver) ActivateProfile(ctx context.Context, boiler *string, name string, at *time.Time) (*model.BoilerInfo, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	switchTime := time.Now()
+	if at != nil {
+		switchTime = *at
+	}
+	return b.ActivateProfile(ctx, name, switchTime)
+}
+
+// CancelProfileSwitch is the resolver for the cancelProfileSwitch field.
+func (r *mutationResolver) CancelProfileSwitch(ctx context.Context, boiler *string) (*model.BoilerInfo, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	return b.CancelProfileSwitch(ctx)
+}
+
+// Boost is the resolver for the boost field.
+func (r *mutationResolver) Boost(ctx context.Context, boiler *string, targetTemp float64, minutes float64) (*model.BoilerInfo, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	return b.Boost(ctx, targetTemp, minutes)
+}
+
+// CancelBoost is the resolver for the cancelBoost field.
+func (r *mutationResolver) CancelBoost(ctx context.Context, boiler *string) (*model.BoilerInfo, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	return b.CancelBoost(ctx)
+}
+
+// Rules is the resolver for the rules field.
+func (r *profileResolver) Rules(ctx context.Context, obj *model.Profile) ([]*model.Rule, error) {
+	return rulesWithWarnings(obj.Rules), nil
+}
+
+// Boilers is the resolver for the boilers field.
+func (r *queryResolver) Boilers(ctx context.Context) ([]*model.BoilerInfo, error) {
+	names := make([]string, 0, len(r.Resolver.Boilers))
+	for name := range r.Resolver.Boilers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	infos := make([]*model.BoilerInfo, len(names))
+	for i, name := range names {
+		info, err := r.Resolver.Boilers[name].GetInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		infos[i] = info
+	}
+	return infos, nil
+}
+
 // Boiler is the resolver for the boiler field.
-func (r *queryResolver) Boiler(ctx context.Context) (*model.BoilerInfo, error) {
-	return r.Resolver.Boiler.GetInfo(ctx)
+func (r *queryResolver) Boiler(ctx context.Context, name *string) (*model.BoilerInfo, error) {
+	b, err := r.boiler(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.GetInfo(ctx)
 }
 
 // Sensor is the resolver for the sensor field.
@@ -84,6 +268,33 @@ func (r *queryResolver) Sensor(ctx context.Context, name string, position string
 	return result[len(result)-1], nil
 }
 
+// SensorHealth is the resolver for the sensorHealth field.
+func (r *queryResolver) SensorHealth(ctx context.Context, name string, position string) (*model.SensorHealth, error) {
+	sensor, ok := r.Resolver.Sensors[name+":"+position]
+	if !ok {
+		return nil, fmt.Errorf("unknown sensor: %s:%s", name, position)
+	}
+	return sensor.Health(ctx, time.Now())
+}
+
+// SensorsHealth is the resolver for the sensorsHealth field.
+func (r *queryResolver) SensorsHealth(ctx context.Context) ([]*model.SensorHealth, error) {
+	ids := make([]string, 0, len(r.Resolver.Sensors))
+	for id := range r.Resolver.Sensors {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	healths := make([]*model.SensorHealth, len(ids))
+	for i, id := range ids {
+		health, err := r.Resolver.Sensors[id].Health(ctx, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		healths[i] = health
+	}
+	return healths, nil
+}
+
 // SensorRange is the resolver for the sensorRange field.
 func (r *queryResolver) SensorRange(ctx context.Context, name string, position string, from *time.Time, to *time.Time) ([]*model.Measure, error) {
 	defaultFrom := time.Now().Add(-24 * time.Hour)
@@ -98,7 +309,11 @@ func (r *queryResolver) SensorRange(ctx context.Context, name string, position s
 }
 
 // SwitchHistory is the resolver for the switchHistory field.
-func (r *queryResolver) SwitchHistory(ctx context.Context, from *time.Time, to *time.Time) ([]*model.SwitchSample, error) {
+func (r *queryResolver) SwitchHistory(ctx context.Context, boiler *string, from *time.Time, to *time.Time) ([]*model.SwitchSample, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
 	defaultFrom := time.Now().Add(-24 * time.Hour)
 	defaultTo := time.Now()
 	if from == nil {
@@ -107,11 +322,15 @@ func (r *queryResolver) SwitchHistory(ctx context.Context, from *time.Time, to *
 	if to == nil {
 		to = &defaultTo
 	}
-	return r.Resolver.Boiler.GetSwitchHistory(ctx, *from, *to)
+	return b.GetSwitchHistory(ctx, *from, *to)
 }
 
 // OverheatingProtectionHistory is the resolver for the overheatingProtectionHistory field.
-func (r *queryResolver) OverheatingProtectionHistory(ctx context.Context, from *time.Time, to *time.Time) ([]*model.OverheatingProtectionSample, error) {
+func (r *queryResolver) OverheatingProtectionHistory(ctx context.Context, boiler *string, from *time.Time, to *time.Time) ([]*model.OverheatingProtectionSample, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
 	defaultFrom := time.Now().Add(-24 * time.Hour)
 	defaultTo := time.Now()
 	if from == nil {
@@ -120,12 +339,223 @@ func (r *queryResolver) OverheatingProtectionHistory(ctx context.Context, from *
 	if to == nil {
 		to = &defaultTo
 	}
-	return r.Resolver.Boiler.GetOverheatingProtectionHistory(ctx, *from, *to)
+	return b.GetOverheatingProtectionHistory(ctx, *from, *to)
+}
+
+// WarmUpRate is the resolver for the warmUpRate field.
+func (r *queryResolver) WarmUpRate(ctx context.Context, boiler *string) (*model.WarmUpRate, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	return b.GetWarmUpRate(ctx)
+}
+
+// ThermalModel is the resolver for the thermalModel field.
+func (r *queryResolver) ThermalModel(ctx context.Context, boiler *string) (*thermal.Model, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	return thermal.Load(ctx, r.Client, b.Config.Name)
+}
+
+// OverheatingStatus is the resolver for the overheatingStatus field.
+func (r *queryResolver) OverheatingStatus(ctx context.Context, boiler *string) (*model.OverheatingStatus, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	return b.GetOverheatingStatus(ctx)
+}
+
+// OverheatingIndexHistory is the resolver for the overheatingIndexHistory field.
+func (r *queryResolver) OverheatingIndexHistory(ctx context.Context, boiler *string, from *time.Time, to *time.Time) ([]*model.OverheatingIndexSample, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	defaultFrom := time.Now().Add(-24 * time.Hour)
+	defaultTo := time.Now()
+	if from == nil {
+		from = &defaultFrom
+	}
+	if to == nil {
+		to = &defaultTo
+	}
+	return b.GetOverheatingIndexHistory(ctx, *from, *to)
+}
+
+// OverheatingSettings is the resolver for the overheatingSettings field.
+func (r *queryResolver) OverheatingSettings(ctx context.Context, boiler *string) (*model.OverheatingSettings, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	return b.GetOverheatingSettings(ctx)
+}
+
+// AuditLog is the resolver for the auditLog field.
+func (r *queryResolver) AuditLog(ctx context.Context, boiler *string, from *time.Time, to *time.Time, kind *model.AuditKind, offset *int, limit *int) (*model.AuditLogPage, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	defaultFrom := time.Now().Add(-24 * time.Hour)
+	defaultTo := time.Now()
+	if from == nil {
+		from = &defaultFrom
+	}
+	if to == nil {
+		to = &defaultTo
+	}
+	pageOffset, pageLimit := 0, 0
+	if offset != nil {
+		pageOffset = *offset
+	}
+	if limit != nil {
+		pageLimit = *limit
+	}
+	return b.GetAuditLog(ctx, *from, *to, kind, pageOffset, pageLimit)
+}
+
+// FrostProtectionEvents is the resolver for the frostProtectionEvents field.
+func (r *queryResolver) FrostProtectionEvents(ctx context.Context, boiler *string, from *time.Time, to *time.Time) ([]*model.FrostProtectionEvent, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	defaultFrom := time.Now().Add(-24 * time.Hour)
+	defaultTo := time.Now()
+	if from == nil {
+		from = &defaultFrom
+	}
+	if to == nil {
+		to = &defaultTo
+	}
+	return b.GetFrostProtectionEvents(ctx, *from, *to)
+}
+
+// HeatingStats is the resolver for the heatingStats field.
+func (r *queryResolver) HeatingStats(ctx context.Context, boiler *string, from *time.Time, to *time.Time, bucket *model.StatsBucket) ([]*model.HeatingStats, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	defaultFrom := time.Now().Add(-7 * 24 * time.Hour)
+	defaultTo := time.Now()
+	defaultBucket := model.StatsBucketDay
+	if from == nil {
+		from = &defaultFrom
+	}
+	if to == nil {
+		to = &defaultTo
+	}
+	if bucket == nil {
+		bucket = &defaultBucket
+	}
+	return b.GetHeatingStats(ctx, *from, *to, *bucket)
+}
+
+// HeatingSessions is the resolver for the heatingSessions field.
+func (r *queryResolver) HeatingSessions(ctx context.Context, boiler *string, from *time.Time, to *time.Time) ([]*model.HeatingSession, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	defaultFrom := time.Now().Add(-24 * time.Hour)
+	defaultTo := time.Now()
+	if from == nil {
+		from = &defaultFrom
+	}
+	if to == nil {
+		to = &defaultTo
+	}
+	return b.GetHeatingSessions(ctx, *from, *to)
+}
+
+// HeatingCosts is the resolver for the heatingCosts field.
+func (r *queryResolver) HeatingCosts(ctx context.Context, boiler *string, from *time.Time, to *time.Time) ([]*model.DailyCost, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	defaultFrom := time.Now().Add(-7 * 24 * time.Hour)
+	defaultTo := time.Now()
+	if from == nil {
+		from = &defaultFrom
+	}
+	if to == nil {
+		to = &defaultTo
+	}
+	return b.GetHeatingCosts(ctx, *from, *to)
+}
+
+// RuleRunCosts is the resolver for the ruleRunCosts field.
+func (r *queryResolver) RuleRunCosts(ctx context.Context, boiler *string, from *time.Time, to *time.Time) ([]*model.RuleRunCost, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	defaultFrom := time.Now().Add(-7 * 24 * time.Hour)
+	defaultTo := time.Now()
+	if from == nil {
+		from = &defaultFrom
+	}
+	if to == nil {
+		to = &defaultTo
+	}
+	return b.GetRuleRunCosts(ctx, *from, *to)
+}
+
+// MonthlyCost is the resolver for the monthlyCost field.
+func (r *queryResolver) MonthlyCost(ctx context.Context, boiler *string, month *time.Time) (*model.MonthlyCost, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	if month == nil {
+		now := time.Now()
+		month = &now
+	}
+	return b.GetMonthlyCost(ctx, *month)
+}
+
+// DegreeDays is the resolver for the degreeDays field.
+func (r *queryResolver) DegreeDays(ctx context.Context, boiler *string, from *time.Time, to *time.Time, bucket *model.DegreeDayBucket) ([]*model.DegreeDayStats, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	if b.Config.OutdoorSensor == "" {
+		return nil, fmt.Errorf("boiler %s has no outdoor sensor", b.Config.Name)
+	}
+	outdoor, ok := r.Resolver.Sensors[b.Config.OutdoorSensor]
+	if !ok {
+		return nil, fmt.Errorf("unknown sensor: %s", b.Config.OutdoorSensor)
+	}
+	defaultFrom := time.Now().Add(-12 * 7 * 24 * time.Hour)
+	defaultTo := time.Now()
+	defaultBucket := model.DegreeDayBucketWeek
+	if from == nil {
+		from = &defaultFrom
+	}
+	if to == nil {
+		to = &defaultTo
+	}
+	if bucket == nil {
+		bucket = &defaultBucket
+	}
+	return model.DegreeDays(ctx, b, outdoor, *from, *to, *bucket)
 }
 
 // Boiler is the resolver for the boiler field.
-func (r *subscriptionResolver) Boiler(ctx context.Context) (<-chan *model.BoilerInfo, error) {
-	return r.Resolver.Boiler.Listen(ctx)
+func (r *subscriptionResolver) Boiler(ctx context.Context, name *string) (<-chan *model.BoilerInfo, error) {
+	b, err := r.boiler(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.Listen(ctx)
 }
 
 // Sensor is the resolver for the sensor field.
@@ -133,15 +563,32 @@ func (r *subscriptionResolver) Sensor(ctx context.Context, name string, position
 	return r.Resolver.Sensors[name+":"+position].Listen(ctx)
 }
 
+// OverheatingStatus is the resolver for the overheatingStatus field.
+func (r *subscriptionResolver) OverheatingStatus(ctx context.Context, boiler *string) (<-chan *model.OverheatingStatus, error) {
+	b, err := r.boiler(boiler)
+	if err != nil {
+		return nil, err
+	}
+	return b.ListenOverheatingStatus(ctx)
+}
+
+// BoilerInfo returns BoilerInfoResolver implementation.
+func (r *Resolver) BoilerInfo() BoilerInfoResolver { return &boilerInfoResolver{r} }
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
+// Profile returns ProfileResolver implementation.
+func (r *Resolver) Profile() ProfileResolver { return &profileResolver{r} }
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
 // Subscription returns SubscriptionResolver implementation.
 func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
 
+type boilerInfoResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
+type profileResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/store"
+	"stupid-caldaia/controller/thermal"
+)
+
+// Fits the thermal model of the house on the recorded history:
+//
+//	controller identify -from 2024-01-01 -to 2024-01-15 [-boiler caldaia] [-outdoor temperatura:esterno] [-power 24]
+func identify(args []string) error {
+	flags := flag.NewFlagSet("identify", flag.ExitOnError)
+	from := flags.String("from", time.Now().AddDate(0, 0, -14).Format(time.DateOnly), "start of the history, YYYY-MM-DD or RFC3339")
+	to := flags.String("to", time.Now().Format(time.RFC3339), "end of the history, YYYY-MM-DD or RFC3339")
+	boilerName := flags.String("boiler", "", "boiler to model, the first configured one if empty")
+	indoorName := flags.String("sensor", "", "indoor sensor, the first boiler control sensor if empty")
+	outdoorName := flags.String("outdoor", "", "outdoor sensor, optional")
+	power := flags.Float64("power", 0, "boiler power in kW, optional")
+	save := flags.Bool("save", true, "save the fitted parameters")
+	flags.Parse(args)
+
+	fromTime, err := parseTime(*from)
+	if err != nil {
+		return err
+	}
+	toTime, err := parseTime(*to)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	config, err := store.LoadConfig()
+	if err != nil {
+		return err
+	}
+	client, sensors, boilers := config.CreateObjects(ctx)
+	boiler := boilers[0]
+	if *boilerName != "" {
+		index := slices.IndexFunc(boilers, func(b *model.Boiler) bool { return b.Config.Name == *boilerName })
+		if index < 0 {
+			return fmt.Errorf("unknown boiler: %s", *boilerName)
+		}
+		boiler = boilers[index]
+	}
+	if *indoorName == "" {
+		*indoorName = boiler.Config.Sensors[0].Id
+	}
+
+	indoorSensor, ok := sensors[*indoorName]
+	if !ok {
+		return fmt.Errorf("unknown sensor: %s", *indoorName)
+	}
+	indoor, err := indoorSensor.Get(ctx, fromTime, toTime)
+	if err != nil {
+		return err
+	}
+	switches, err := boiler.GetSwitchHistory(ctx, fromTime, toTime)
+	if err != nil {
+		return err
+	}
+	var outdoor []*model.Measure
+	if *outdoorName != "" {
+		outdoorSensor, ok := sensors[*outdoorName]
+		if !ok {
+			return fmt.Errorf("unknown sensor: %s", *outdoorName)
+		}
+		outdoor, err = outdoorSensor.Get(ctx, fromTime, toTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("🔬 Fitting thermal model of %s from %s to %s\n", boiler.Config.Name, fromTime.Format(time.RFC3339), toTime.Format(time.RFC3339))
+	m, err := thermal.Fit(indoor, switches, outdoor, *power)
+	if err != nil {
+		return err
+	}
+	fmt.Println(m)
+
+	if *save {
+		if err := thermal.Save(ctx, client, boiler.Config.Name, m); err != nil {
+			return err
+		}
+		fmt.Printf("💾 Saved to %s\n", thermal.Key(boiler.Config.Name))
+	}
+	return nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func runIdentify() {
+	if err := identify(os.Args[2:]); err != nil {
+		fmt.Println(fmt.Errorf("❌ Thermal model identification failed: %w", err))
+		os.Exit(1)
+	}
+}
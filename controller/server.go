@@ -5,11 +5,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"time"
 
 	"stupid-caldaia/controller/graph"
+	"stupid-caldaia/controller/graph/model"
 	"stupid-caldaia/controller/store"
 
 	"github.com/gorilla/websocket"
@@ -27,67 +29,30 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "identify" {
+		runIdentify()
+		return
+	}
+
 	ctx := context.Background()
 	config, err := store.LoadConfig()
 	if err != nil {
 		panic(err)
 	}
 
-	client, sensors, boiler := config.CreateObjects(context.Background())
-
-	// Start boiler switch controller
-	go func() {
-		for i := 0; i < maxRescueAttempts; i++ {
-			err := store.BoilerSwitchControl(ctx, boiler, sensors["temperatura:centrale"])
-			if err != nil {
-				fmt.Println(fmt.Errorf("boiler switch control failure: %w", err))
-			} else {
-				fmt.Println(fmt.Errorf("boiler switch control terminated unexpectedly"))
-			}
-			if i < maxRescueAttempts-1 {
-				fmt.Println("Attempting rescue of service in 5 seconds")
-				time.Sleep(5 * time.Second)
-			}
-		}
-		fmt.Printf("💀 Tried %d times to rescues this service. That's bad - panic time!", maxRescueAttempts)
-		panic(err)
-	}()
+	client, sensors, boilers := config.CreateObjects(context.Background())
 
-	// Start rule timing controller
-	go func() {
-		for i := 0; i < maxRescueAttempts; i++ {
-			err := store.RuleTimingControl(ctx, boiler)
-			if err != nil {
-				fmt.Println(fmt.Errorf("rule timing control failure: %w", err))
-			} else {
-				fmt.Println(fmt.Errorf("rule timing control terminated unexpectedly"))
-			}
-			if i < maxRescueAttempts-1 {
-				fmt.Println("Attempting rescue of service in 5 seconds")
-				time.Sleep(5 * time.Second)
-			}
-		}
-		fmt.Printf("💀 Tried %d times to rescues this service. That's bad - panic time!", maxRescueAttempts)
-		panic(err)
-	}()
-
-	// Start overheating controller
-	go func() {
-		for i := 0; i < maxRescueAttempts; i++ {
-			err := store.BoilerOverheatingControl(ctx, boiler, store.OVERHEATING_CHECK_PERIOD)
-			if err != nil {
-				fmt.Println(fmt.Errorf("rule timing control failure: %w", err))
-			} else {
-				fmt.Println(fmt.Errorf("rule timing control terminated unexpectedly"))
-			}
-			if i < maxRescueAttempts-1 {
-				fmt.Println("Attempting rescue of service in 5 seconds")
-				time.Sleep(5 * time.Second)
-			}
+	// Every zone runs its own set of controllers
+	boilersByName := make(map[string]*model.Boiler)
+	for _, boiler := range boilers {
+		boilersByName[boiler.Config.Name] = boiler
+		reference, err := store.NewReferenceTemperature(ctx, client, boiler.Config, sensors)
+		if err != nil {
+			panic(err)
 		}
-		fmt.Printf("💀 Tried %d times to rescues this service. That's bad - panic time!", maxRescueAttempts)
-		panic(err)
-	}()
+		sensors[reference.Sensor.Id] = reference.Sensor
+		superviseZone(ctx, boiler, reference)
+	}
 
 	// Host api
 	c := cors.New(cors.Options{
@@ -100,7 +65,12 @@ func main() {
 		port = defaultPort
 	}
 
-	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{Client: client, Sensors: sensors, Boiler: boiler}}))
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{
+		Client:        client,
+		Sensors:       sensors,
+		Boilers:       boilersByName,
+		DefaultBoiler: boilers[0].Config.Name,
+	}}))
 	srv.AddTransport(transport.SSE{})
 	srv.AddTransport(transport.POST{})
 	srv.AddTransport(transport.Websocket{
@@ -112,10 +82,82 @@ func main() {
 		},
 	})
 	srv.Use(extension.Introspection{})
+	srv.SetErrorPresenter(graph.ErrorPresenter)
 
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", c.Handler(srv))
+	http.Handle("/query", c.Handler(withAPIActor(srv)))
 
 	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
 	log.Panic(http.ListenAndServe(":"+port, nil))
 }
+
+// Changes made through the API are audited with the address of the client
+func withAPIActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		ctx := model.WithActor(r.Context(), model.ActorAPI+":"+client)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Starts the controllers of one boiler, driven by its reference temperature
+func superviseZone(ctx context.Context, boiler *model.Boiler, reference *store.ReferenceTemperature) {
+	name := boiler.Config.Name
+
+	// Start boiler switch controller
+	go rescue("boiler switch control of "+name, func() error {
+		return store.BoilerSwitchControl(ctx, boiler, reference)
+	})
+
+	// Start rule timing controller
+	go rescue("rule timing control of "+name, func() error {
+		return store.RuleTimingControl(ctx, boiler)
+	})
+
+	// Start scheduled profile switches
+	go rescue("profile switch control of "+name, func() error {
+		return store.ProfileSwitchControl(ctx, boiler)
+	})
+
+	// Start overheating controller
+	go rescue("overheating control of "+name, func() error {
+		return store.BoilerOverheatingControl(ctx, boiler)
+	})
+
+	// Start heartbeats with the worker
+	go rescue("heartbeat of "+name, func() error {
+		return store.HeartbeatControl(ctx, boiler, model.HEARTBEAT_PERIOD)
+	})
+
+	// Start checking the relay follows the commands
+	go rescue("relay acknowledgement of "+name, func() error {
+		return store.RelayAckControl(ctx, boiler, model.HEARTBEAT_PERIOD)
+	})
+
+	// Start warm up learning for optimal start
+	go rescue("warm up learning of "+name, func() error {
+		return store.WarmUpLearningControl(ctx, boiler, reference.Sensor, store.WARMUP_LEARNING_INTERVAL)
+	})
+}
+
+// Keeps a long running service alive, up to maxRescueAttempts times
+func rescue(name string, service func() error) {
+	var err error
+	for i := 0; i < maxRescueAttempts; i++ {
+		err = service()
+		if err != nil {
+			fmt.Println(fmt.Errorf("%s failure: %w", name, err))
+		} else {
+			fmt.Println(fmt.Errorf("%s terminated unexpectedly", name))
+		}
+		if i < maxRescueAttempts-1 {
+			fmt.Println("Attempting rescue of service in 5 seconds")
+			time.Sleep(5 * time.Second)
+		}
+	}
+	fmt.Printf("💀 Tried %d times to rescues this service. That's bad - panic time!", maxRescueAttempts)
+	panic(err)
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+const (
+	subscriberBufferSize = 100
+)
+
+// In-process pub/sub, only reaches subscribers living in the same process
+type localBroker struct {
+	lock        sync.Mutex
+	subscribers map[string][]chan []byte
+}
+
+func newLocalBroker() *localBroker {
+	return &localBroker{subscribers: make(map[string][]chan []byte)}
+}
+
+func (b *localBroker) Publish(ctx context.Context, channel string, message []byte) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, subscriber := range b.subscribers[channel] {
+		select {
+		case subscriber <- slices.Clone(message):
+		default:
+			// Same as a slow Redis subscriber, the message is lost
+			fmt.Printf("dropping message on channel '%s', subscriber is not keeping up\n", channel)
+		}
+	}
+	return nil
+}
+
+func (b *localBroker) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	subscriber := make(chan []byte, subscriberBufferSize)
+	b.subscribers[channel] = append(b.subscribers[channel], subscriber)
+	go func() {
+		<-ctx.Done()
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		b.subscribers[channel] = slices.DeleteFunc(b.subscribers[channel], func(c chan []byte) bool {
+			return c == subscriber
+		})
+		close(subscriber)
+	}()
+	return subscriber, nil
+}
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+type memorySeries struct {
+	options SeriesOptions
+	samples []Sample // Always sorted by timestamp
+	rules   []*memoryRule
+}
+
+type memoryRule struct {
+	destKey        string
+	bucketDuration int64
+	bucketStart    int64
+	started        bool
+}
+
+// Fully in-memory storage. Nothing survives a restart, good for tests and for
+// running the controller without any database around.
+//
+// Time series behave like RedisTimeSeries with a LAST duplicate policy: adding
+// a sample on an existing timestamp overwrites it.
+type Memory struct {
+	*localBroker
+	lock     sync.Mutex
+	values   map[string][]byte
+	series   map[string]*memorySeries
+	journals map[string][]Entry // Always sorted by timestamp
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		localBroker: newLocalBroker(),
+		values:      make(map[string][]byte),
+		series:      make(map[string]*memorySeries),
+		journals:    make(map[string][]Entry),
+	}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	value, ok := m.values[key]
+	if !ok {
+		return nil, Nil
+	}
+	return slices.Clone(value), nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.values[key] = slices.Clone(value)
+	return nil
+}
+
+func (m *Memory) CompareAndSet(ctx context.Context, key string, expected []byte, value []byte) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	current, ok := m.values[key]
+	if ok != (expected != nil) || !bytes.Equal(current, expected) {
+		return false, nil
+	}
+	m.values[key] = slices.Clone(value)
+	return true, nil
+}
+
+func (m *Memory) Exists(ctx context.Context, key string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, isValue := m.values[key]
+	_, isSeries := m.series[key]
+	_, isJournal := m.journals[key]
+	return isValue || isSeries || isJournal, nil
+}
+
+func (m *Memory) Del(ctx context.Context, keys ...string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, key := range keys {
+		delete(m.values, key)
+		delete(m.series, key)
+		delete(m.journals, key)
+	}
+	return nil
+}
+
+func (m *Memory) TSCreate(ctx context.Context, key string, options *SeriesOptions) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.series[key]; ok {
+		return fmt.Errorf("series '%s' already exists", key)
+	}
+	series := &memorySeries{}
+	if options != nil {
+		series.options = *options
+	}
+	m.series[key] = series
+	return nil
+}
+
+func (m *Memory) TSCreateRule(ctx context.Context, sourceKey string, destKey string, aggregator Aggregator, bucketDuration int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if aggregator != Avg {
+		return fmt.Errorf("unsupported aggregator: %d", aggregator)
+	}
+	if bucketDuration <= 0 {
+		return fmt.Errorf("invalid bucket duration: %d", bucketDuration)
+	}
+	source, ok := m.series[sourceKey]
+	if !ok {
+		return fmt.Errorf("series '%s' does not exist", sourceKey)
+	}
+	if _, ok := m.series[destKey]; !ok {
+		return fmt.Errorf("series '%s' does not exist", destKey)
+	}
+	source.rules = append(source.rules, &memoryRule{destKey: destKey, bucketDuration: bucketDuration})
+	return nil
+}
+
+func (m *Memory) TSAdd(ctx context.Context, key string, timestamp int64, value float64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.add(key, timestamp, value)
+	return nil
+}
+
+// Needs the lock to be held
+func (m *Memory) add(key string, timestamp int64, value float64) {
+	series, ok := m.series[key]
+	if !ok {
+		// Same as Redis, adding to a missing series creates it
+		series = &memorySeries{}
+		m.series[key] = series
+	}
+	index, found := slices.BinarySearchFunc(series.samples, timestamp, compareTimestamp)
+	if found {
+		series.samples[index].Value = value
+	} else {
+		series.samples = slices.Insert(series.samples, index, Sample{Timestamp: timestamp, Value: value})
+	}
+
+	// Apply retention relative to the most recent sample
+	if retention := series.options.Retention; retention > 0 {
+		latest := series.samples[len(series.samples)-1].Timestamp
+		firstKept, _ := slices.BinarySearchFunc(series.samples, latest-retention, compareTimestamp)
+		series.samples = series.samples[firstKept:]
+	}
+
+	// Compactions emit a bucket once a sample of a newer bucket shows up
+	for _, rule := range series.rules {
+		bucketStart := timestamp - timestamp%rule.bucketDuration
+		switch {
+		case !rule.started:
+			rule.bucketStart = bucketStart
+			rule.started = true
+		case bucketStart > rule.bucketStart:
+			m.compact(series, rule, rule.bucketStart)
+			rule.bucketStart = bucketStart
+		case bucketStart < rule.bucketStart:
+			// Late sample on an already closed bucket
+			m.compact(series, rule, bucketStart)
+		}
+	}
+}
+
+// Needs the lock to be held
+func (m *Memory) compact(source *memorySeries, rule *memoryRule, bucketStart int64) {
+	samples := source.rangeOf(bucketStart, bucketStart+rule.bucketDuration-1)
+	if len(samples) == 0 {
+		return
+	}
+	sum := 0.0
+	for _, sample := range samples {
+		sum += sample.Value
+	}
+	m.add(rule.destKey, bucketStart, sum/float64(len(samples)))
+}
+
+func (m *Memory) TSRange(ctx context.Context, key string, from int64, to int64) ([]Sample, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	series, ok := m.series[key]
+	if !ok {
+		return nil, fmt.Errorf("series '%s' does not exist", key)
+	}
+	return slices.Clone(series.rangeOf(from, to)), nil
+}
+
+func (m *Memory) TSRevRange(ctx context.Context, key string, from int64, to int64, count int) ([]Sample, error) {
+	samples, err := m.TSRange(ctx, key, from, to)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(samples)
+	if count > 0 && len(samples) > count {
+		samples = samples[:count]
+	}
+	return samples, nil
+}
+
+func (m *Memory) JAppend(ctx context.Context, key string, timestamp int64, data []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	entries := m.journals[key]
+	// After any entry on the same timestamp
+	index, _ := slices.BinarySearchFunc(entries, timestamp+1, compareEntryTimestamp)
+	m.journals[key] = slices.Insert(entries, index, Entry{Timestamp: timestamp, Data: slices.Clone(data)})
+	return nil
+}
+
+func (m *Memory) JRevRange(ctx context.Context, key string, from int64, to int64, count int) ([]Entry, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	entries := m.journals[key]
+	start, _ := slices.BinarySearchFunc(entries, from, compareEntryTimestamp)
+	end, _ := slices.BinarySearchFunc(entries, to+1, compareEntryTimestamp)
+	result := []Entry{}
+	for i := end - 1; i >= start && (count <= 0 || len(result) < count); i-- {
+		result = append(result, Entry{Timestamp: entries[i].Timestamp, Data: slices.Clone(entries[i].Data)})
+	}
+	return result, nil
+}
+
+func compareEntryTimestamp(entry Entry, timestamp int64) int {
+	return compareTimestamp(Sample{Timestamp: entry.Timestamp}, timestamp)
+}
+
+func (s *memorySeries) rangeOf(from int64, to int64) []Sample {
+	start, _ := slices.BinarySearchFunc(s.samples, from, compareTimestamp)
+	end, found := slices.BinarySearchFunc(s.samples, to, compareTimestamp)
+	if found {
+		end++
+	}
+	if start >= end {
+		return nil
+	}
+	return s.samples[start:end]
+}
+
+func compareTimestamp(sample Sample, timestamp int64) int {
+	switch {
+	case sample.Timestamp < timestamp:
+		return -1
+	case sample.Timestamp > timestamp:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Journals keep about this many entries, the oldest are dropped
+const redisJournalMaxLen = 100000
+
+// Adapter for a Redis Stack server (needs the RedisTimeSeries module)
+type Redis struct {
+	client *redis.Client
+}
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, Nil
+	}
+	return data, err
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte) error {
+	return r.client.Set(ctx, key, value, 0).Err()
+}
+
+var errNotExpected = errors.New("value is not the expected one")
+
+func (r *Redis) CompareAndSet(ctx context.Context, key string, expected []byte, value []byte) (bool, error) {
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, key).Bytes()
+		switch {
+		case err == redis.Nil:
+			if expected != nil {
+				return errNotExpected
+			}
+		case err != nil:
+			return err
+		case expected == nil || !bytes.Equal(current, expected):
+			return errNotExpected
+		}
+		// Fails if the key changed since the WATCH
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, value, 0)
+			return nil
+		})
+		return err
+	}, key)
+	if err == errNotExpected || err == redis.TxFailedErr {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *Redis) Exists(ctx context.Context, key string) (bool, error) {
+	count, err := r.client.Exists(ctx, key).Result()
+	return count > 0, err
+}
+
+func (r *Redis) Del(ctx context.Context, keys ...string) error {
+	return r.client.Del(ctx, keys...).Err()
+}
+
+func (r *Redis) TSCreate(ctx context.Context, key string, options *SeriesOptions) error {
+	redisOptions := &redis.TSOptions{}
+	if options != nil {
+		redisOptions.Retention = int(options.Retention)
+		redisOptions.Labels = options.Labels
+	}
+	return r.client.TSCreateWithArgs(ctx, key, redisOptions).Err()
+}
+
+func (r *Redis) TSCreateRule(ctx context.Context, sourceKey string, destKey string, aggregator Aggregator, bucketDuration int64) error {
+	var redisAggregator redis.Aggregator
+	switch aggregator {
+	case Avg:
+		redisAggregator = redis.Avg
+	default:
+		return fmt.Errorf("unsupported aggregator: %d", aggregator)
+	}
+	return r.client.TSCreateRule(ctx, sourceKey, destKey, redisAggregator, int(bucketDuration)).Err()
+}
+
+func (r *Redis) TSAdd(ctx context.Context, key string, timestamp int64, value float64) error {
+	return r.client.TSAdd(ctx, key, timestamp, value).Err()
+}
+
+func (r *Redis) TSRange(ctx context.Context, key string, from int64, to int64) ([]Sample, error) {
+	data, err := r.client.TSRange(ctx, key, int(from), int(to)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return toSamples(data), nil
+}
+
+func (r *Redis) TSRevRange(ctx context.Context, key string, from int64, to int64, count int) ([]Sample, error) {
+	options := &redis.TSRevRangeOptions{Count: count}
+	data, err := r.client.TSRevRangeWithArgs(ctx, key, int(from), int(to), options).Result()
+	if err != nil {
+		return nil, err
+	}
+	return toSamples(data), nil
+}
+
+// Journals are streams with the timestamp as the first part of the entry IDs,
+// so ranges are read by ID. Redis refuses an ID older than the last entry, a
+// late entry is filed when it was appended instead and keeps its timestamp in
+// a field.
+func (r *Redis) JAppend(ctx context.Context, key string, timestamp int64, data []byte) error {
+	args := &redis.XAddArgs{
+		Stream: key,
+		MaxLen: redisJournalMaxLen,
+		Approx: true,
+		ID:     fmt.Sprintf("%d-*", timestamp),
+		Values: map[string]any{"timestamp": timestamp, "data": data},
+	}
+	err := r.client.XAdd(ctx, args).Err()
+	if err != nil && strings.Contains(err.Error(), "equal or smaller than the target stream top item") {
+		args.ID = "*"
+		err = r.client.XAdd(ctx, args).Err()
+	}
+	return err
+}
+
+func (r *Redis) JRevRange(ctx context.Context, key string, from int64, to int64, count int) ([]Entry, error) {
+	start, end := strconv.FormatInt(to, 10), strconv.FormatInt(from, 10)
+	var messages []redis.XMessage
+	var err error
+	if count > 0 {
+		messages, err = r.client.XRevRangeN(ctx, key, start, end, int64(count)).Result()
+	} else {
+		messages, err = r.client.XRevRange(ctx, key, start, end).Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, len(messages))
+	for i, message := range messages {
+		timestamp, err := entryTimestamp(message)
+		if err != nil {
+			return nil, err
+		}
+		data, _ := message.Values["data"].(string)
+		entries[i] = Entry{Timestamp: timestamp, Data: []byte(data)}
+	}
+	return entries, nil
+}
+
+// From the timestamp field, or from the ID for entries appended before it
+// was there
+func entryTimestamp(message redis.XMessage) (int64, error) {
+	if value, ok := message.Values["timestamp"].(string); ok {
+		timestamp, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected stream entry timestamp '%s': %w", value, err)
+		}
+		return timestamp, nil
+	}
+	timestamp, err := strconv.ParseInt(strings.SplitN(message.ID, "-", 2)[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected stream entry ID '%s': %w", message.ID, err)
+	}
+	return timestamp, nil
+}
+
+func (r *Redis) Publish(ctx context.Context, channel string, message []byte) error {
+	return r.client.Publish(ctx, channel, message).Err()
+}
+
+func (r *Redis) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	sub := r.client.Subscribe(ctx, channel)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, fmt.Errorf("failed to receive from PubSub '%s': %w", channel, err)
+	}
+
+	messages := make(chan []byte)
+	go func() {
+		defer close(messages)
+		defer sub.Close()
+		redisChannel := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-redisChannel:
+				if !ok {
+					return
+				}
+				select {
+				case messages <- []byte(msg.Payload):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return messages, nil
+}
+
+func toSamples(data []redis.TSTimestampValue) []Sample {
+	samples := make([]Sample, len(data))
+	for i, sample := range data {
+		samples[i] = Sample{Timestamp: sample.Timestamp, Value: sample.Value}
+	}
+	return samples
+}
@@ -0,0 +1,424 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	sqlitePollInterval = 100 * time.Millisecond // How often new messages are looked for
+	sqliteMessagesKept = 1000                   // Older messages are deleted as new ones come
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS kv (
+	key   TEXT PRIMARY KEY,
+	value BLOB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS series (
+	key       TEXT PRIMARY KEY,
+	retention INTEGER NOT NULL DEFAULT 0,
+	labels    TEXT
+);
+CREATE TABLE IF NOT EXISTS samples (
+	key       TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	value     REAL NOT NULL,
+	PRIMARY KEY (key, timestamp)
+) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS compaction_rules (
+	source_key      TEXT NOT NULL,
+	dest_key        TEXT NOT NULL,
+	bucket_duration INTEGER NOT NULL,
+	bucket_start    INTEGER,
+	PRIMARY KEY (source_key, dest_key)
+);
+CREATE TABLE IF NOT EXISTS journal (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	key       TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	data      BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS journal_key_timestamp ON journal (key, timestamp);
+CREATE TABLE IF NOT EXISTS messages (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	origin  TEXT NOT NULL,
+	channel TEXT NOT NULL,
+	data    BLOB NOT NULL
+);
+`
+
+// File backed storage for small devices where running Redis is too much.
+//
+// Time series and compactions behave like the in-memory storage. Messages
+// reach the subscribers of the same process right away, and go through the
+// database to the other processes opening the same file, at most
+// sqlitePollInterval late.
+type SQLite struct {
+	broker *localBroker
+	db     *sql.DB
+	origin string // Tells the messages of this process apart
+	done   chan struct{}
+	polled sync.WaitGroup
+}
+
+func NewSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serialises writes and avoids "database is locked"
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create sqlite schema: %w", err)
+	}
+	// Only the messages published from now on
+	var lastID int64
+	if err := db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM messages").Scan(&lastID); err != nil {
+		db.Close()
+		return nil, err
+	}
+	origin := make([]byte, 8)
+	if _, err := rand.Read(origin); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &SQLite{broker: newLocalBroker(), db: db, origin: hex.EncodeToString(origin), done: make(chan struct{})}
+	s.polled.Add(1)
+	go s.poll(lastID)
+	return s, nil
+}
+
+func (s *SQLite) Close() error {
+	close(s.done)
+	s.polled.Wait()
+	return s.db.Close()
+}
+
+func (s *SQLite) Publish(ctx context.Context, channel string, message []byte) error {
+	s.broker.Publish(ctx, channel, message)
+	result, err := s.db.ExecContext(ctx, "INSERT INTO messages (origin, channel, data) VALUES (?, ?, ?)", s.origin, channel, message)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "DELETE FROM messages WHERE id <= ?", id-sqliteMessagesKept)
+	return err
+}
+
+func (s *SQLite) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	return s.broker.Subscribe(ctx, channel)
+}
+
+// Hands the messages published by the other processes to the subscribers of
+// this one
+func (s *SQLite) poll(lastID int64) {
+	defer s.polled.Done()
+	ticker := time.NewTicker(sqlitePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+		ctx := context.Background()
+		rows, err := s.db.QueryContext(ctx, "SELECT id, origin, channel, data FROM messages WHERE id > ? ORDER BY id", lastID)
+		if err != nil {
+			fmt.Printf("could not read sqlite messages: %v\n", err)
+			continue
+		}
+		type message struct {
+			id      int64
+			origin  string
+			channel string
+			data    []byte
+		}
+		// The cursor only moves past the messages actually read, the others
+		// are read again at the next poll
+		messages := []message{}
+		for rows.Next() {
+			m := message{}
+			if err := rows.Scan(&m.id, &m.origin, &m.channel, &m.data); err != nil {
+				fmt.Printf("could not read sqlite messages: %v\n", err)
+				break
+			}
+			lastID = m.id
+			if m.origin != s.origin {
+				messages = append(messages, m)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			fmt.Printf("could not read sqlite messages: %v\n", err)
+		}
+		rows.Close()
+		for _, m := range messages {
+			s.broker.Publish(ctx, m.channel, m.data)
+		}
+	}
+}
+
+func (s *SQLite) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.QueryRowContext(ctx, "SELECT value FROM kv WHERE key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, Nil
+	}
+	return value, err
+}
+
+func (s *SQLite) Set(ctx context.Context, key string, value []byte) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO kv (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value", key, value)
+	return err
+}
+
+func (s *SQLite) CompareAndSet(ctx context.Context, key string, expected []byte, value []byte) (bool, error) {
+	var result sql.Result
+	var err error
+	if expected == nil {
+		result, err = s.db.ExecContext(ctx, "INSERT INTO kv (key, value) VALUES (?, ?) ON CONFLICT (key) DO NOTHING", key, value)
+	} else {
+		result, err = s.db.ExecContext(ctx, "UPDATE kv SET value = ? WHERE key = ? AND value = ?", value, key, expected)
+	}
+	if err != nil {
+		return false, err
+	}
+	changed, err := result.RowsAffected()
+	return changed == 1, err
+}
+
+func (s *SQLite) Exists(ctx context.Context, key string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM kv WHERE key = ?1) OR EXISTS (SELECT 1 FROM series WHERE key = ?1) OR EXISTS (SELECT 1 FROM journal WHERE key = ?1)", key).Scan(&exists)
+	return exists, err
+}
+
+func (s *SQLite) Del(ctx context.Context, keys ...string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, key := range keys {
+		for _, query := range []string{
+			"DELETE FROM kv WHERE key = ?1",
+			"DELETE FROM series WHERE key = ?1",
+			"DELETE FROM samples WHERE key = ?1",
+			"DELETE FROM compaction_rules WHERE source_key = ?1 OR dest_key = ?1",
+			"DELETE FROM journal WHERE key = ?1",
+		} {
+			if _, err := tx.ExecContext(ctx, query, key); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLite) TSCreate(ctx context.Context, key string, options *SeriesOptions) error {
+	if options == nil {
+		options = &SeriesOptions{}
+	}
+	labels, err := json.Marshal(options.Labels)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx, "INSERT INTO series (key, retention, labels) VALUES (?, ?, ?) ON CONFLICT (key) DO NOTHING", key, options.Retention, string(labels))
+	if err != nil {
+		return err
+	}
+	if created, _ := result.RowsAffected(); created == 0 {
+		return fmt.Errorf("series '%s' already exists", key)
+	}
+	return nil
+}
+
+func (s *SQLite) TSCreateRule(ctx context.Context, sourceKey string, destKey string, aggregator Aggregator, bucketDuration int64) error {
+	if aggregator != Avg {
+		return fmt.Errorf("unsupported aggregator: %d", aggregator)
+	}
+	if bucketDuration <= 0 {
+		return fmt.Errorf("invalid bucket duration: %d", bucketDuration)
+	}
+	for _, key := range []string{sourceKey, destKey} {
+		var exists bool
+		err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM series WHERE key = ?)", key).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("series '%s' does not exist", key)
+		}
+	}
+	_, err := s.db.ExecContext(ctx, "INSERT INTO compaction_rules (source_key, dest_key, bucket_duration) VALUES (?, ?, ?)", sourceKey, destKey, bucketDuration)
+	return err
+}
+
+func (s *SQLite) TSAdd(ctx context.Context, key string, timestamp int64, value float64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := s.add(ctx, tx, key, timestamp, value); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLite) add(ctx context.Context, tx *sql.Tx, key string, timestamp int64, value float64) error {
+	// Same as Redis, adding to a missing series creates it
+	_, err := tx.ExecContext(ctx, "INSERT INTO series (key) VALUES (?) ON CONFLICT (key) DO NOTHING", key)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO samples (key, timestamp, value) VALUES (?, ?, ?) ON CONFLICT (key, timestamp) DO UPDATE SET value = excluded.value", key, timestamp, value)
+	if err != nil {
+		return err
+	}
+
+	// Apply retention relative to the most recent sample
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM samples
+		WHERE key = ?1
+		AND (SELECT retention FROM series WHERE key = ?1) > 0
+		AND timestamp < (SELECT MAX(timestamp) FROM samples WHERE key = ?1) - (SELECT retention FROM series WHERE key = ?1)`, key)
+	if err != nil {
+		return err
+	}
+
+	// Compactions emit a bucket once a sample of a newer bucket shows up
+	type rule struct {
+		destKey        string
+		bucketDuration int64
+		bucketStart    sql.NullInt64
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT dest_key, bucket_duration, bucket_start FROM compaction_rules WHERE source_key = ?", key)
+	if err != nil {
+		return err
+	}
+	rules := []rule{}
+	for rows.Next() {
+		r := rule{}
+		if err := rows.Scan(&r.destKey, &r.bucketDuration, &r.bucketStart); err != nil {
+			rows.Close()
+			return err
+		}
+		rules = append(rules, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range rules {
+		bucketStart := timestamp - timestamp%r.bucketDuration
+		switch {
+		case !r.bucketStart.Valid:
+			err = s.setBucketStart(ctx, tx, key, r.destKey, bucketStart)
+		case bucketStart > r.bucketStart.Int64:
+			err = s.compact(ctx, tx, key, r.destKey, r.bucketStart.Int64, r.bucketDuration)
+			if err == nil {
+				err = s.setBucketStart(ctx, tx, key, r.destKey, bucketStart)
+			}
+		case bucketStart < r.bucketStart.Int64:
+			// Late sample on an already closed bucket
+			err = s.compact(ctx, tx, key, r.destKey, bucketStart, r.bucketDuration)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLite) setBucketStart(ctx context.Context, tx *sql.Tx, sourceKey string, destKey string, bucketStart int64) error {
+	_, err := tx.ExecContext(ctx, "UPDATE compaction_rules SET bucket_start = ? WHERE source_key = ? AND dest_key = ?", bucketStart, sourceKey, destKey)
+	return err
+}
+
+func (s *SQLite) compact(ctx context.Context, tx *sql.Tx, sourceKey string, destKey string, bucketStart int64, bucketDuration int64) error {
+	var average sql.NullFloat64
+	err := tx.QueryRowContext(ctx, "SELECT AVG(value) FROM samples WHERE key = ? AND timestamp BETWEEN ? AND ?", sourceKey, bucketStart, bucketStart+bucketDuration-1).Scan(&average)
+	if err != nil || !average.Valid {
+		return err
+	}
+	return s.add(ctx, tx, destKey, bucketStart, average.Float64)
+}
+
+func (s *SQLite) TSRange(ctx context.Context, key string, from int64, to int64) ([]Sample, error) {
+	return s.query(ctx, key, "SELECT timestamp, value FROM samples WHERE key = ? AND timestamp BETWEEN ? AND ? ORDER BY timestamp ASC", key, from, to)
+}
+
+func (s *SQLite) TSRevRange(ctx context.Context, key string, from int64, to int64, count int) ([]Sample, error) {
+	limit := -1 // No limit in SQLite
+	if count > 0 {
+		limit = count
+	}
+	return s.query(ctx, key, "SELECT timestamp, value FROM samples WHERE key = ? AND timestamp BETWEEN ? AND ? ORDER BY timestamp DESC LIMIT ?", key, from, to, limit)
+}
+
+func (s *SQLite) query(ctx context.Context, key string, query string, args ...any) ([]Sample, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM series WHERE key = ?)", key).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("series '%s' does not exist", key)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	samples := []Sample{}
+	for rows.Next() {
+		sample := Sample{}
+		if err := rows.Scan(&sample.Timestamp, &sample.Value); err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
+
+func (s *SQLite) JAppend(ctx context.Context, key string, timestamp int64, data []byte) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO journal (key, timestamp, data) VALUES (?, ?, ?)", key, timestamp, data)
+	return err
+}
+
+func (s *SQLite) JRevRange(ctx context.Context, key string, from int64, to int64, count int) ([]Entry, error) {
+	limit := -1 // No limit in SQLite
+	if count > 0 {
+		limit = count
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT timestamp, data FROM journal WHERE key = ? AND timestamp BETWEEN ? AND ? ORDER BY timestamp DESC, id DESC LIMIT ?", key, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []Entry{}
+	for rows.Next() {
+		entry := Entry{}
+		if err := rows.Scan(&entry.Timestamp, &entry.Data); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
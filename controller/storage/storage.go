@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// Nil is returned by KeyValue.Get when the key does not exist
+var Nil = errors.New("storage: nil")
+
+// Sample is a single point of a time series. Timestamp is in milliseconds.
+type Sample struct {
+	Timestamp int64
+	Value     float64
+}
+
+type SeriesOptions struct {
+	Retention int64 // In milliseconds, 0 means keep forever
+	Labels    map[string]string
+}
+
+type Aggregator int
+
+const (
+	Avg Aggregator = iota
+)
+
+// Holds the state of the boiler (and anything else that is a plain blob)
+type KeyValue interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Exists(ctx context.Context, key string) (bool, error)
+	Del(ctx context.Context, keys ...string) error
+	// Sets key to value only if it still holds expected, a nil expected means
+	// the key must not exist. Returns false, and changes nothing, otherwise.
+	CompareAndSet(ctx context.Context, key string, expected []byte, value []byte) (bool, error)
+}
+
+// Append only series of samples, modelled after RedisTimeSeries
+type TimeSeries interface {
+	TSCreate(ctx context.Context, key string, options *SeriesOptions) error
+	// Downsample every new sample of sourceKey into destKey using buckets of bucketDuration milliseconds
+	TSCreateRule(ctx context.Context, sourceKey string, destKey string, aggregator Aggregator, bucketDuration int64) error
+	TSAdd(ctx context.Context, key string, timestamp int64, value float64) error
+	// Samples between from and to (inclusive) in ascending order
+	TSRange(ctx context.Context, key string, from int64, to int64) ([]Sample, error)
+	// Samples between from and to (inclusive) in descending order, count 0 means no limit
+	TSRevRange(ctx context.Context, key string, from int64, to int64, count int) ([]Sample, error)
+}
+
+// Entry of a journal. Timestamp is in milliseconds.
+type Entry struct {
+	Timestamp int64
+	Data      []byte
+}
+
+// Append only log of blobs, modelled after Redis streams. Entries on the same
+// timestamp keep the order they were appended in.
+type Journal interface {
+	JAppend(ctx context.Context, key string, timestamp int64, data []byte) error
+	// Entries between from and to (inclusive) in descending order, count 0 means no limit
+	JRevRange(ctx context.Context, key string, from int64, to int64, count int) ([]Entry, error)
+}
+
+type Broker interface {
+	Publish(ctx context.Context, channel string, message []byte) error
+	// The subscription is in place when Subscribe returns. The returned channel
+	// is closed once ctx is done.
+	Subscribe(ctx context.Context, channel string) (<-chan []byte, error)
+}
+
+type Storage interface {
+	KeyValue
+	TimeSeries
+	Journal
+	Broker
+}
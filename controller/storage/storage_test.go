@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Every test runs against each of the backends that need no external server
+func testBackends(t *testing.T) map[string]Storage {
+	sqlite, err := NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]Storage{
+		"memory": NewMemory(),
+		"sqlite": sqlite,
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := backend.Get(ctx, "missing"); err != Nil {
+				t.Fatalf("Expected Nil error for missing key but got %v", err)
+			}
+			if err := backend.Set(ctx, "key", []byte("value")); err != nil {
+				t.Fatal(err)
+			}
+			value, err := backend.Get(ctx, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != "value" {
+				t.Fatalf("Expected 'value' but got '%s'", value)
+			}
+			backend.Del(ctx, "key")
+			if exists, _ := backend.Exists(ctx, "key"); exists {
+				t.Fatal("Expected key to be deleted")
+			}
+		})
+	}
+}
+
+func TestRange(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			backend.TSCreate(ctx, "series", nil)
+			// Out of order on purpose, and one duplicate that should overwrite
+			for _, sample := range []Sample{{3, 3}, {1, 1}, {2, 0}, {2, 2}, {5, 5}} {
+				backend.TSAdd(ctx, "series", sample.Timestamp, sample.Value)
+			}
+
+			testCases := []struct {
+				name  string
+				from  int64
+				to    int64
+				count int
+				rev   bool
+				want  []Sample
+			}{
+				{name: "All", from: 0, to: 10, want: []Sample{{1, 1}, {2, 2}, {3, 3}, {5, 5}}},
+				{name: "Inclusive", from: 2, to: 3, want: []Sample{{2, 2}, {3, 3}}},
+				{name: "Empty", from: 6, to: 10, want: []Sample{}},
+				{name: "Reverse", from: 0, to: 3, rev: true, want: []Sample{{3, 3}, {2, 2}, {1, 1}}},
+				{name: "Reverse last only", from: 0, to: 4, count: 1, rev: true, want: []Sample{{3, 3}}},
+			}
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					var got []Sample
+					var err error
+					if tc.rev {
+						got, err = backend.TSRevRange(ctx, "series", tc.from, tc.to, tc.count)
+					} else {
+						got, err = backend.TSRange(ctx, "series", tc.from, tc.to)
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(got) != len(tc.want) {
+						t.Fatalf("Wanted %v but got %v", tc.want, got)
+					}
+					for i := range got {
+						if got[i] != tc.want[i] {
+							t.Fatalf("Wanted %v but got %v", tc.want, got)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestRetention(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			backend.TSCreate(ctx, "series", &SeriesOptions{Retention: 10})
+			for timestamp := int64(0); timestamp <= 30; timestamp += 5 {
+				backend.TSAdd(ctx, "series", timestamp, 1)
+			}
+			samples, _ := backend.TSRange(ctx, "series", 0, 30)
+			if len(samples) != 3 || samples[0].Timestamp != 20 {
+				t.Fatalf("Expected only samples from 20 to 30 but got %v", samples)
+			}
+		})
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			backend.TSCreate(ctx, "raw", nil)
+			backend.TSCreate(ctx, "compacted", nil)
+			if err := backend.TSCreateRule(ctx, "raw", "compacted", Avg, 10); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, sample := range []Sample{{0, 1}, {5, 3}, {12, 10}, {25, 7}} {
+				backend.TSAdd(ctx, "raw", sample.Timestamp, sample.Value)
+			}
+			// Last bucket is still open, so it shouldn't be there
+			want := []Sample{{0, 2}, {10, 10}}
+			got, _ := backend.TSRange(ctx, "compacted", 0, 100)
+			if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+				t.Fatalf("Wanted %v but got %v", want, got)
+			}
+
+			// A late sample updates its closed bucket
+			backend.TSAdd(ctx, "raw", 15, 20)
+			got, _ = backend.TSRange(ctx, "compacted", 10, 10)
+			if len(got) != 1 || got[0].Value != 15 {
+				t.Fatalf("Wanted bucket 10 to be 15 but got %v", got)
+			}
+		})
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	for name, backend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			messages, err := backend.Subscribe(ctx, "channel")
+			if err != nil {
+				t.Fatal(err)
+			}
+			backend.Publish(ctx, "other", []byte("nope"))
+			backend.Publish(ctx, "channel", []byte("hello"))
+			select {
+			case msg := <-messages:
+				if string(msg) != "hello" {
+					t.Fatalf("Expected 'hello' but got '%s'", msg)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Timeout waiting for message")
+			}
+
+			cancel()
+			select {
+			case _, ok := <-messages:
+				if ok {
+					t.Fatal("Expected channel to be closed")
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Timeout waiting for channel to close")
+			}
+		})
+	}
+}
+
+// The controller and the worker are separate processes opening the same file
+func TestSQLitePubSubAcrossProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	controller, err := NewSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer controller.Close()
+	worker, err := NewSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages, err := worker.Subscribe(ctx, "channel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range []string{"first", "second"} {
+		if err := controller.Publish(ctx, "channel", []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"first", "second"} {
+		select {
+		case msg := <-messages:
+			if string(msg) != want {
+				t.Fatalf("Expected '%s' but got '%s'", want, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for '%s' from the other process", want)
+		}
+	}
+}
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			// Out of order on purpose, entries on the same timestamp are all kept
+			for _, entry := range []Entry{{3, []byte("c")}, {1, []byte("a")}, {2, []byte("b1")}, {2, []byte("b2")}, {5, []byte("e")}} {
+				if err := backend.JAppend(ctx, "journal", entry.Timestamp, entry.Data); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			testCases := []struct {
+				name  string
+				from  int64
+				to    int64
+				count int
+				want  []string
+			}{
+				{"All", 0, 10, 0, []string{"e", "c", "b2", "b1", "a"}},
+				{"Inclusive bounds", 2, 3, 0, []string{"c", "b2", "b1"}},
+				{"Count", 0, 10, 2, []string{"e", "c"}},
+				{"Empty", 6, 10, 0, []string{}},
+			}
+			for _, tc := range testCases {
+				entries, err := backend.JRevRange(ctx, "journal", tc.from, tc.to, tc.count)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := make([]string, len(entries))
+				for i, entry := range entries {
+					got[i] = string(entry.Data)
+				}
+				if !slices.Equal(got, tc.want) {
+					t.Fatalf("%s: wanted %v but got %v", tc.name, tc.want, got)
+				}
+			}
+
+			backend.Del(ctx, "journal")
+			if entries, _ := backend.JRevRange(ctx, "journal", 0, 10, 0); len(entries) != 0 {
+				t.Fatal("Expected journal to be deleted")
+			}
+		})
+	}
+}
+
+func TestCompareAndSet(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			testCases := []struct {
+				name     string
+				expected []byte
+				value    string
+				wantOk   bool
+				want     string
+			}{
+				{"Create when missing", nil, "a", true, "a"},
+				{"Create when present", nil, "b", false, "a"},
+				{"Stale expected", []byte("b"), "c", false, "a"},
+				{"Current expected", []byte("a"), "c", true, "c"},
+			}
+			for _, tc := range testCases {
+				ok, err := backend.CompareAndSet(ctx, "cas", tc.expected, []byte(tc.value))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok != tc.wantOk {
+					t.Fatalf("%s: wanted %v but got %v", tc.name, tc.wantOk, ok)
+				}
+				value, err := backend.Get(ctx, "cas")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(value) != tc.want {
+					t.Fatalf("%s: wanted '%s' but got '%s'", tc.name, tc.want, value)
+				}
+			}
+			backend.Del(ctx, "cas")
+		})
+	}
+}
@@ -3,8 +3,12 @@ package store
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/storage"
+	"time"
+	_ "time/tzdata" // The images have no timezone database, every binary loading a config needs it
 
 	"github.com/redis/go-redis/v9"
 )
@@ -14,10 +18,27 @@ const (
 	DefaultConfigPath = "../config.json"
 )
 
+const DefaultControlSensor = "temperatura:centrale"
+
+const (
+	RedisBackend  = "redis"
+	SQLiteBackend = "sqlite"
+	MemoryBackend = "memory"
+)
+
+type StorageConfig struct {
+	Backend string // One of RedisBackend (default), SQLiteBackend or MemoryBackend
+	Path    string // Database file, only for SQLiteBackend
+}
+
 type Config struct {
 	Sensors []model.SensorOptions
+	Storage StorageConfig
 	Redis   redis.Options
-	Boiler  model.BoilerConfig
+	Boilers []model.BoilerConfig // One per zone, the first one is the default for the API
+	Boiler  model.BoilerConfig   // Single boiler configs from before zones, used when Boilers is empty
+	// IANA name of the home timezone rules repeat in, like "Europe/Rome". The local one when empty.
+	Timezone string
 }
 
 func LoadConfig() (Config, error) {
@@ -40,9 +61,12 @@ func LoadConfig() (Config, error) {
 	return config, nil
 }
 
-func (c *Config) CreateObjects(ctx context.Context) (*redis.Client, map[string]*model.Sensor, *model.Boiler) {
+func (c *Config) CreateObjects(ctx context.Context) (storage.Storage, map[string]*model.Sensor, []*model.Boiler) {
 	// DB client
-	client := redis.NewClient(&c.Redis)
+	client, err := c.createStorage()
+	if err != nil {
+		panic(err)
+	}
 
 	// Sensors
 	sensors := make(map[string]*model.Sensor)
@@ -54,10 +78,88 @@ func (c *Config) CreateObjects(ctx context.Context) (*redis.Client, map[string]*
 		sensors[sensor.Id] = sensor
 	}
 
-	// Boiler
-	boiler, err := model.NewBoiler(ctx, client, c.Boiler)
+	// Boilers, one per zone
+	boilerConfigs, err := c.BoilerConfigs()
 	if err != nil {
 		panic(err)
 	}
-	return client, sensors, boiler
+	boilers := make([]*model.Boiler, len(boilerConfigs))
+	for i, boilerConfig := range boilerConfigs {
+		for _, controlSensor := range boilerConfig.Sensors {
+			if _, ok := sensors[controlSensor.Id]; !ok {
+				panic(fmt.Errorf("boiler '%s' is controlled by unknown sensor '%s'", boilerConfig.Name, controlSensor.Id))
+			}
+		}
+		if _, ok := sensors[boilerConfig.OutdoorSensor]; boilerConfig.OutdoorSensor != "" && !ok {
+			panic(fmt.Errorf("boiler '%s' has unknown outdoor sensor '%s'", boilerConfig.Name, boilerConfig.OutdoorSensor))
+		}
+		boilers[i], err = model.NewBoiler(ctx, client, boilerConfig)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return client, sensors, boilers
+}
+
+// Configured zones with defaults filled in
+func (c *Config) BoilerConfigs() ([]model.BoilerConfig, error) {
+	configs := c.Boilers
+	if len(configs) == 0 {
+		configs = []model.BoilerConfig{c.Boiler}
+	}
+	location := time.Local
+	if c.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(c.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+	names := map[string]bool{}
+	pins := map[int]bool{}
+	result := make([]model.BoilerConfig, len(configs))
+	for i, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("boiler %d has no name", i)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("boiler name '%s' is used more than once", config.Name)
+		}
+		if pins[config.SwitchPin] {
+			return nil, fmt.Errorf("boiler '%s' switch pin %d is used by another boiler", config.Name, config.SwitchPin)
+		}
+		if config.Burner.PowerKW < 0 || config.Burner.Efficiency < 0 || config.Burner.Efficiency > 1 {
+			return nil, fmt.Errorf("boiler '%s' burner needs a positive power and an efficiency between 0 and 1", config.Name)
+		}
+		if err := config.Tariff.Validate(); err != nil {
+			return nil, fmt.Errorf("boiler '%s' tariff: %w", config.Name, err)
+		}
+		names[config.Name] = true
+		pins[config.SwitchPin] = true
+		if len(config.Sensors) == 0 {
+			if config.Sensor == "" {
+				config.Sensor = DefaultControlSensor
+			}
+			config.Sensors = []model.ControlSensor{{Id: config.Sensor, Weight: 1}}
+		}
+		config.Location = location
+		result[i] = config
+	}
+	return result, nil
+}
+
+func (c *Config) createStorage() (storage.Storage, error) {
+	switch c.Storage.Backend {
+	case RedisBackend, "":
+		return storage.NewRedis(redis.NewClient(&c.Redis)), nil
+	case SQLiteBackend:
+		if c.Storage.Path == "" {
+			return nil, fmt.Errorf("sqlite storage needs a database path")
+		}
+		return storage.NewSQLite(c.Storage.Path)
+	case MemoryBackend:
+		return storage.NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", c.Storage.Backend)
+	}
 }
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+
+	"stupid-caldaia/controller/graph/model"
+)
+
+func TestBoilerConfigs(t *testing.T) {
+	testCases := []struct {
+		name      string
+		config    Config
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name:      "Single boiler",
+			config:    Config{Boiler: model.BoilerConfig{Name: "caldaia", SwitchPin: 4}},
+			wantNames: []string{"caldaia"},
+		},
+		{
+			name: "Zones",
+			config: Config{Boilers: []model.BoilerConfig{
+				{Name: "giorno", SwitchPin: 4},
+				{Name: "notte", SwitchPin: 5, Sensor: "temperatura:camera"},
+			}},
+			wantNames: []string{"giorno", "notte"},
+		},
+		{
+			name: "Same name",
+			config: Config{Boilers: []model.BoilerConfig{
+				{Name: "giorno", SwitchPin: 4},
+				{Name: "giorno", SwitchPin: 5},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "Same pin",
+			config: Config{Boilers: []model.BoilerConfig{
+				{Name: "giorno", SwitchPin: 4},
+				{Name: "notte", SwitchPin: 4},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "No name",
+			config:  Config{Boilers: []model.BoilerConfig{{SwitchPin: 4}}},
+			wantErr: true,
+		},
+		{
+			name:    "Burner efficiency above 1",
+			config:  Config{Boiler: model.BoilerConfig{Name: "caldaia", Burner: model.BurnerConfig{PowerKW: 24, Efficiency: 1.1}}},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configs, err := tc.config.BoilerConfigs()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(configs) != len(tc.wantNames) {
+				t.Fatalf("Expected %d boilers but got %d", len(tc.wantNames), len(configs))
+			}
+			for i, config := range configs {
+				if config.Name != tc.wantNames[i] {
+					t.Fatalf("Expected boiler %s but got %s", tc.wantNames[i], config.Name)
+				}
+				if len(config.Sensors) == 0 {
+					t.Fatalf("Expected boiler %s to have a control sensor", config.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestBoilerConfigsTimezone(t *testing.T) {
+	config := Config{Boiler: model.BoilerConfig{Name: "caldaia"}, Timezone: "Europe/Rome"}
+	configs, err := config.BoilerConfigs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configs[0].Location == nil || configs[0].Location.String() != "Europe/Rome" {
+		t.Fatalf("Expected the boiler to repeat rules in Europe/Rome but got %v", configs[0].Location)
+	}
+
+	config.Timezone = "Europe/Nowhere"
+	if _, err := config.BoilerConfigs(); err == nil {
+		t.Fatal("Expected an unknown timezone to be refused")
+	}
+}
+
+// The controller and worker images have no system timezone database
+func TestBinariesEmbedTimezoneDatabase(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is needed to list the dependencies")
+	}
+	for _, binary := range []string{"stupid-caldaia/controller", "stupid-caldaia/lettore", "stupid-caldaia/lettore/mock"} {
+		deps, err := exec.Command("go", "list", "-deps", binary).Output()
+		if err != nil {
+			t.Fatalf("Could not list the dependencies of %s: %v", binary, err)
+		}
+		if !slices.Contains(strings.Fields(string(deps)), "time/tzdata") {
+			t.Fatalf("Expected %s to embed time/tzdata, a named timezone fails without a system one", binary)
+		}
+	}
+}
@@ -9,45 +9,75 @@ import (
 )
 
 const (
-	OVERHEATING_CHECK_PERIOD  = 15 * time.Second
-	OVERHEATING_ON_THRESHOLD  = 0.9
-	OVERHEATING_OFF_THRESHOLD = 0.2
+	CONTROL_REFRESH_PERIOD   = 30 * time.Second
+	CONTROL_HISTORY          = time.Hour
+	WARMUP_LEARNING_PERIOD   = 14 * 24 * time.Hour
+	WARMUP_LEARNING_INTERVAL = time.Hour
+	DEFAULT_MAX_LEAD         = 2 * time.Hour
+	DEFAULT_FAILSAFE_CYCLE   = time.Hour
 )
 
-// Long running function to enable/disable boiler based on overheating
-func BoilerOverheatingControl(ctx context.Context, boiler *model.Boiler, checkInterval time.Duration) error {
-	ticker := time.Tick(checkInterval)
+// Long running function to enable/disable boiler based on overheating.
+// Settings are read at every check, so API changes apply without a restart.
+func BoilerOverheatingControl(ctx context.Context, boiler *model.Boiler) error {
+	ctx = model.WithActor(ctx, model.ActorOverheatingControl)
+	settings, err := boiler.GetOverheatingSettings(ctx)
+	if err != nil {
+		return err
+	}
 	for {
 		select {
-		case <-ticker:
-			currentIndex, err := model.GetCurrentOverheatingIndex(ctx, boiler)
-			if err != nil {
-				return err
-			}
-			info, err := boiler.GetInfo(ctx)
-			if err != nil {
-				return err
-			}
-			isProtected := info.IsOverheatingProtectionActive
+		case <-time.After(settings.CheckPeriod()):
+		case <-ctx.Done():
+			return nil
+		}
+		settings, err = boiler.GetOverheatingSettings(ctx)
+		if err != nil {
+			return err
+		}
+		status, err := boiler.GetOverheatingStatus(ctx)
+		if err != nil {
+			return err
+		}
 
-			if currentIndex > OVERHEATING_ON_THRESHOLD && !isProtected {
-				log.Printf("Enabling overheating protection. Recorded index above threshold.")
-				boiler.SetOverheating(ctx, true)
+		if status.Index > settings.OnThreshold && !status.IsProtectionActive {
+			log.Printf("Enabling overheating protection. Recorded index above threshold.")
+			// Still above the threshold at the next check, so it is tried again
+			if err := boiler.SetOverheating(ctx, true); err != nil {
+				log.Printf("Could not enable overheating protection: %v", err)
+			} else {
+				status.IsProtectionActive = true
+				status.MinutesLeft = 0
 			}
+		}
 
-			if currentIndex < OVERHEATING_OFF_THRESHOLD && isProtected {
-				log.Printf("Disabling overheating protection. Cooldown reached.")
-				boiler.SetOverheating(ctx, false)
+		if status.Index < settings.OffThreshold && status.IsProtectionActive {
+			log.Printf("Disabling overheating protection. Cooldown reached.")
+			if err := boiler.SetOverheating(ctx, false); err != nil {
+				log.Printf("Could not disable overheating protection: %v", err)
+			} else {
+				status, err = boiler.GetOverheatingStatus(ctx)
+				if err != nil {
+					return err
+				}
 			}
-		case <-ctx.Done():
-			return nil
+		}
+
+		err = boiler.RecordOverheatingStatus(ctx, status)
+		if err != nil {
+			return fmt.Errorf("could not record overheating index: %w", err)
 		}
 	}
 }
 
 // Long running function to control the On/Off state
-func BoilerSwitchControl(ctx context.Context, boiler *model.Boiler, temperatureSensor *model.Sensor) error {
-	temperatureListener, err := temperatureSensor.Listen(ctx)
+func BoilerSwitchControl(ctx context.Context, boiler *model.Boiler, reference *ReferenceTemperature) error {
+	ctx = model.WithActor(ctx, model.ActorSwitchControl)
+	strategy, err := NewControlStrategy(boiler.Config.Control)
+	if err != nil {
+		return err
+	}
+	temperatureListener, err := reference.Listen(ctx)
 	if err != nil {
 		return err
 	}
@@ -59,61 +89,359 @@ func BoilerSwitchControl(ctx context.Context, boiler *model.Boiler, temperatureS
 	if err != nil {
 		return err
 	}
+	awayListener, err := boiler.ListenAway(ctx)
+	if err != nil {
+		return err
+	}
+	boostListener, err := boiler.ListenBoost(ctx)
+	if err != nil {
+		return err
+	}
+	lastReason := ""
+	frostProtecting := false
+	frostRecorded := false
+	refresh := CONTROL_REFRESH_PERIOD
+	var lastInControl *string
+	inControlRecorded := false
 	for {
 		// Wait for updates to can affect control...
-		var currentTemperature *float64 = nil
 		select {
 		case <-ruleListener:
 		case <-overheatingListener:
-		case measure := <-temperatureListener:
-			currentTemperature = &measure.Value
+		case <-awayListener:
+		case <-boostListener:
+		case _, ok := <-temperatureListener:
+			if !ok {
+				return fmt.Errorf("temperature listener for %s closed", reference)
+			}
+		case <-time.After(refresh):
+			// Time based strategies need to act even when nothing happens,
+			// and sensors going silent must be noticed
+		case <-ctx.Done():
+			return nil
 		}
 		// Actuate control strategy in case of new rules or a new temperature sample
-		// First get average temperature of the last 10 minutes
-		sensorAverageStart := time.Now().Add(-10 * time.Minute)
-		sensorAverageEnd := time.Now()
-		averageTemperature, err := temperatureSensor.GetAverage(ctx, sensorAverageStart, sensorAverageEnd)
+		// First fuse the control sensors that are not stale
+		now := time.Now()
+		referenceTemperature, err := reference.Update(ctx, now)
 		if err != nil {
-			return fmt.Errorf("could not get average temperature for sensor '%s': %w", temperatureSensor.Name, err)
+			return err
 		}
 
 		// Get latest boiler state
 		boilerInfo, err := boiler.GetInfo(ctx)
 		if err != nil {
-			return fmt.Errorf("could not get Boiler info to set default reference temperature: %w", err)
+			return fmt.Errorf("could not get Boiler info: %w", err)
+		}
+		// Back from away and done boosting when their time is up
+		if boilerInfo.Away.IsOver(now) {
+			boilerInfo, err = boiler.CancelAwayMode(ctx)
+			if err != nil {
+				return fmt.Errorf("could not end away mode: %w", err)
+			}
+		}
+		if boilerInfo.Boost.IsOver(now) {
+			boilerInfo, err = boiler.CancelBoost(ctx)
+			if err != nil {
+				return fmt.Errorf("could not end boost: %w", err)
+			}
+		}
+		refresh = controlRefresh(boilerInfo, now)
+		// What heating costs is charged to the rule in control
+		var inControl *string
+		if boilerInfo.RuleInControl != nil {
+			inControl = &boilerInfo.RuleInControl.ID
+		}
+		if !inControlRecorded || !sameRuleID(inControl, lastInControl) {
+			// Costs are not worth stopping control for, try again next time
+			err = boiler.RecordRuleInControl(ctx, now, inControl)
+			if err != nil {
+				fmt.Println(err)
+				inControlRecorded = false
+			} else {
+				lastInControl = inControl
+				inControlRecorded = true
+			}
+		}
+
+		// Safety stops don't wait for the burner minimum ON time
+		var decision ControlDecision
+		safety := false
+		switch {
+		case boilerInfo.LastWorkerHeartbeat != nil && !boilerInfo.WorkerOnline:
+			// Nobody drives the relay, don't pretend it is heating
+			decision = ControlDecision{model.StateOff, "worker offline"}
+			safety = true
+		case referenceTemperature == nil:
+			// Without a temperature we can trust, the strategy can't be trusted either
+			decision = failsafeDecision(boiler.Config.Failsafe, now)
+			safety = true
+		default:
+			decision, err = strategyDecision(ctx, boiler, reference, strategy, boilerInfo, *referenceTemperature, now)
+			if err != nil {
+				return err
+			}
+		}
+		// Can heat only if not protected from overheating, whatever the strategy says
+		if decision.State == model.StateOn && boilerInfo.IsOverheatingProtectionActive {
+			decision = ControlDecision{model.StateOff, "overheating protection active"}
+			safety = true
+		}
+		// Never let the house freeze, whatever the rules say
+		wasFrostProtecting := frostProtecting
+		decision, frostProtecting = frostProtectionDecision(decision, referenceTemperature, boiler.FrostTemperature(), boilerInfo.IsOverheatingProtectionActive)
+		if frostProtecting && !wasFrostProtecting {
+			fmt.Printf("🥶 Frost protection of %s: %s\n", boiler.Config.Name, decision.Reason)
+		}
+		if !frostProtecting {
+			frostRecorded = false
+		} else if !frostRecorded {
+			// Heating comes first, the record is tried again next time
+			err = boiler.RecordFrostProtection(ctx, now, *referenceTemperature, boiler.FrostTemperature())
+			if err != nil {
+				fmt.Println(err)
+			} else {
+				frostRecorded = true
+			}
+		}
+		if decision.Reason != lastReason {
+			fmt.Printf("🎛️  Control decision %s: %s\n", decision.State, decision.Reason)
+			lastReason = decision.Reason
+		}
+		_, err = boiler.Switch(ctx, decision.State, safety)
+		if err != nil {
+			return fmt.Errorf("failed to set boiler state: %w", err)
+		}
+	}
+}
+
+// Asks the strategy, with everything it may need
+func strategyDecision(ctx context.Context, boiler *model.Boiler, reference *ReferenceTemperature, strategy ControlStrategy, boilerInfo *model.BoilerInfo, referenceTemperature float64, now time.Time) (ControlDecision, error) {
+	// Recent history for strategies that look at trends
+	historyStart := now.Add(-CONTROL_HISTORY)
+	temperatureHistory, err := reference.Sensor.Get(ctx, historyStart, now)
+	if err != nil {
+		return ControlDecision{}, fmt.Errorf("could not get reference temperature history: %w", err)
+	}
+	switchHistory, err := boiler.GetSwitchHistory(ctx, historyStart, now)
+	if err != nil {
+		return ControlDecision{}, fmt.Errorf("could not get switch history: %w", err)
+	}
+
+	// Active rules, plus the upcoming ones we have to heat ahead for. While
+	// away they are all suspended and only the frost protection minimum is
+	// held, a boost overrides everything.
+	rules := model.ActiveRules(boilerInfo.Rules)
+	switch {
+	case boilerInfo.Boost.IsActive(now):
+		rules = []*model.Rule{boilerInfo.Boost.Rule()}
+	case boilerInfo.Away.IsActive(now):
+		rules = []*model.Rule{boilerInfo.Away.Rule()}
+	case boiler.Config.OptimalStart:
+		warmUpRate, err := boiler.GetWarmUpRate(ctx)
+		if err != nil {
+			return ControlDecision{}, err
 		}
+		maxLead := time.Duration(boiler.Config.MaxLeadMinutes * float64(time.Minute))
+		if maxLead <= 0 {
+			maxLead = DEFAULT_MAX_LEAD
+		}
+		rules = append(rules, preheatingRules(boilerInfo.Rules, referenceTemperature, warmUpRate, maxLead, now)...)
+	}
+
+	// Only the one with the highest priority decides
+	inControl := model.RuleInControl(rules)
+	if inControl != nil && inControl.IsInhibit() {
+		return ControlDecision{model.StateOff, fmt.Sprintf("heating inhibited by rule %s", inControl.ID)}, nil
+	}
+	rules = []*model.Rule{}
+	if inControl != nil {
+		rules = append(rules, inControl)
+	}
+
+	// And now, actually asses if we should do it or not
+	return strategy.Decide(&ControlInput{
+		Now:                           now,
+		Rules:                         rules,
+		ReferenceTemperature:          referenceTemperature,
+		TemperatureHistory:            temperatureHistory,
+		SwitchHistory:                 switchHistory,
+		IsOverheatingProtectionActive: boilerInfo.IsOverheatingProtectionActive,
+	}), nil
+}
+
+// Heats below the floor, unless overheating protection is active. Returns
+// true when the floor is what makes the boiler heat.
+func frostProtectionDecision(decision ControlDecision, referenceTemperature *float64, floor float64, isOverheatingProtectionActive bool) (ControlDecision, bool) {
+	if decision.State == model.StateOn || isOverheatingProtectionActive || referenceTemperature == nil || *referenceTemperature >= floor {
+		return decision, false
+	}
+	return ControlDecision{model.StateOn, fmt.Sprintf("%.1f°C below frost protection floor %.1f°C", *referenceTemperature, floor)}, true
+}
+
+func sameRuleID(a *string, b *string) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
 
-		// Get reference temperature
-		var referenceTemperature *float64
-		if averageTemperature != nil {
-			// Good we have an average temperature, we'll use it as reference
-			referenceTemperature = averageTemperature
-		} else if currentTemperature != nil {
-			// Alright, we'll fallback to the current temperature
-			referenceTemperature = currentTemperature
-		} else {
-			// Default case will be to assume current temperature is boiler maximum
-			// This way we can be safe that with no temperature the boiler is OFF
-			referenceTemperature = &boilerInfo.MaxTemp
+// Until the next check, earlier than CONTROL_REFRESH_PERIOD when a boost or the
+// away mode is about to end
+func controlRefresh(boilerInfo *model.BoilerInfo, now time.Time) time.Duration {
+	refresh := CONTROL_REFRESH_PERIOD
+	if boilerInfo.Boost != nil {
+		refresh = min(refresh, max(boilerInfo.Boost.End.Sub(now), 0))
+	}
+	if boilerInfo.Away != nil {
+		refresh = min(refresh, max(boilerInfo.Away.End.Sub(now), 0))
+	}
+	return refresh
+}
+
+// OFF, or ON for the configured share of every cycle so the house doesn't freeze
+func failsafeDecision(config model.FailsafeConfig, now time.Time) ControlDecision {
+	if config.DutyCycle <= 0 {
+		return ControlDecision{model.StateOff, "every control sensor is stale, failsafe OFF"}
+	}
+	cycle := time.Duration(config.CycleMinutes * float64(time.Minute))
+	if cycle <= 0 {
+		cycle = DEFAULT_FAILSAFE_CYCLE
+	}
+	cycleStart := now.Truncate(cycle)
+	onUntil := cycleStart.Add(time.Duration(min(config.DutyCycle, 1) * float64(cycle)))
+	if now.Before(onUntil) {
+		return ControlDecision{model.StateOn, fmt.Sprintf("every control sensor is stale, failsafe duty %.0f%% ON until %s", config.DutyCycle*100, onUntil.Format("15:04:05"))}
+	}
+	return ControlDecision{model.StateOff, fmt.Sprintf("every control sensor is stale, failsafe duty %.0f%% OFF until %s", config.DutyCycle*100, cycleStart.Add(cycle).Format("15:04:05"))}
+}
+
+// Long running function to periodically learn how fast the house warms up
+func WarmUpLearningControl(ctx context.Context, boiler *model.Boiler, temperatureSensor *model.Sensor, interval time.Duration) error {
+	for {
+		now := time.Now()
+		warmUpRate, err := model.LearnWarmUpRate(ctx, boiler, temperatureSensor, now.Add(-WARMUP_LEARNING_PERIOD), now)
+		if err != nil {
+			return fmt.Errorf("could not learn warm up rate: %w", err)
+		}
+		if warmUpRate != nil {
+			fmt.Printf("📈 Learned warm up rate from %d sessions: %.2f%+.3f·T °C/h\n", warmUpRate.Sessions, warmUpRate.Intercept, warmUpRate.Slope)
+			err = boiler.SetWarmUpRate(ctx, warmUpRate)
+			if err != nil {
+				return err
+			}
 		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
 
-		// Can heat if not protected from overheating
-		canHeat := !boilerInfo.IsOverheatingProtectionActive
+// Long running function to tell the worker we are alive, and to notice when
+// the worker isn't
+func HeartbeatControl(ctx context.Context, boiler *model.Boiler, period time.Duration) error {
+	watchErr := make(chan error, 1)
+	go func() {
+		first := true
+		watchErr <- boiler.WatchHeartbeats(ctx, model.WorkerHeartbeat, model.HEARTBEAT_TIMEOUT, func(online bool) {
+			switch {
+			case online:
+				fmt.Printf("💓 Worker of %s is online\n", boiler.Config.Name)
+			case first:
+				fmt.Printf("🫥 No heartbeat from the worker of %s yet\n", boiler.Config.Name)
+			default:
+				fmt.Printf("💔 Worker of %s disappeared, the relay is not being driven\n", boiler.Config.Name)
+			}
+			first = false
+			// Listeners get the new worker status
+			if err := boiler.Notify(ctx); err != nil {
+				fmt.Println(fmt.Errorf("could not notify worker status: %w", err))
+			}
+		})
+	}()
 
-		// And now, actually asses if we should do it or not
-		if shouldHeat(boilerInfo.Rules, *referenceTemperature) && canHeat {
-			_, err = boiler.Switch(ctx, model.StateOn)
-		} else {
-			_, err = boiler.Switch(ctx, model.StateOff)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		err := boiler.SendHeartbeat(ctx, model.ControllerHeartbeat, time.Now())
+		if err != nil {
+			return fmt.Errorf("could not send heartbeat: %w", err)
+		}
+		select {
+		case <-ticker.C:
+		case err := <-watchErr:
+			return err
+		case <-ctx.Done():
+			return nil
 		}
+	}
+}
+
+// Long running function to raise a fault when the relay doesn't follow the
+// commanded state for longer than model.RELAY_ACK_TIMEOUT
+func RelayAckControl(ctx context.Context, boiler *model.Boiler, period time.Duration) error {
+	ctx = model.WithActor(ctx, model.ActorRelayMonitor)
+	ackListener, err := boiler.ListenRelayAcks(ctx)
+	if err != nil {
+		return err
+	}
+	boilerListener, err := boiler.Listen(ctx)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	var mismatchSince *time.Time
+	for {
+		info, err := boiler.GetInfo(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to set boiler state: %w", err)
+			return err
 		}
+		var fault bool
+		mismatchSince, fault = relayFault(info, mismatchSince, time.Now())
+		if fault != info.RelayFault {
+			if fault {
+				fmt.Printf("🚨 Relay of %s is %s but should be %s since %s\n", boiler.Config.Name, info.ActualState, info.CommandedState, mismatchSince.Format(time.TimeOnly))
+			} else {
+				fmt.Printf("✅ Relay of %s follows the commanded state again\n", boiler.Config.Name)
+			}
+			err = boiler.SetRelayFault(ctx, fault)
+			if err != nil {
+				return fmt.Errorf("could not set relay fault: %w", err)
+			}
+		}
+
+		select {
+		case _, ok := <-ackListener:
+			if !ok {
+				return fmt.Errorf("relay acknowledgements closed")
+			}
+		case _, ok := <-boilerListener:
+			if !ok {
+				return fmt.Errorf("boiler updates closed")
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Tracks since when the relay disagrees with the commanded state, it is a
+// fault once that lasts model.RELAY_ACK_TIMEOUT
+func relayFault(info *model.BoilerInfo, mismatchSince *time.Time, now time.Time) (*time.Time, bool) {
+	if !model.IsRelayMismatch(info) {
+		return nil, false
+	}
+	if mismatchSince == nil {
+		mismatchSince = &now
 	}
+	return mismatchSince, now.Sub(*mismatchSince) >= model.RELAY_ACK_TIMEOUT
 }
 
 // Long running function to control start and finish of programmed intervals
 func RuleTimingControl(ctx context.Context, boiler *model.Boiler) error {
+	ctx = model.WithActor(ctx, model.ActorRuleTimer)
 	ruleListener, err := boiler.ListenRules(ctx)
 	if err != nil {
 		return err
@@ -157,6 +485,42 @@ func RuleTimingControl(ctx context.Context, boiler *model.Boiler) error {
 	}
 }
 
+// Long running function to switch profile when a switch is scheduled
+func ProfileSwitchControl(ctx context.Context, boiler *model.Boiler) error {
+	ctx = model.WithActor(ctx, model.ActorProfileScheduler)
+	boilerListener, err := boiler.Listen(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		info, err := boiler.GetInfo(ctx)
+		if err != nil {
+			return err
+		}
+		var switchTimer <-chan time.Time
+		if info.ProfileSwitch != nil {
+			switchTimer = time.After(time.Until(info.ProfileSwitch.At))
+		}
+		select {
+		case <-switchTimer:
+			switched, err := boiler.ApplyProfileSwitch(ctx, time.Now())
+			if err != nil {
+				return fmt.Errorf("could not switch profile: %w", err)
+			}
+			if switched {
+				fmt.Printf("📅 Switched %s to profile %s as scheduled\n", boiler.Config.Name, info.ProfileSwitch.Profile)
+			}
+		case _, ok := <-boilerListener:
+			// The schedule may have changed
+			if !ok {
+				return fmt.Errorf("boiler updates closed")
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
 func waitAndStartRule(cancellableContext context.Context, boiler *model.Boiler, rule *model.Rule) {
 	if rule.WindowStartTimeout(cancellableContext) {
 		// When and if timeout occurred
@@ -179,16 +543,25 @@ func waitAndStopRule(cancellableContext context.Context, boiler *model.Boiler, r
 	}
 }
 
-// Given a set of rules and a reference temperature, the function tells us if
-// the boiler should be heating
-func shouldHeat(rules []*model.Rule, referenceTemperature float64) bool {
+// Upcoming rules that, given how fast we warm up, need heating to start now to
+// reach their target when they would start heating
+func preheatingRules(rules []*model.Rule, referenceTemperature float64, warmUpRate *model.WarmUpRate, maxLead time.Duration, now time.Time) []*model.Rule {
+	if warmUpRate == nil {
+		return nil
+	}
+	preheating := []*model.Rule{}
 	for _, rule := range rules {
-		// Check if the programmed interval is active
-		temperatureNotOk := referenceTemperature < rule.TargetTemp
-		shouldHeat := rule.ShouldBeActive() && temperatureNotOk && !rule.IsBeingDelayed()
-		if shouldHeat {
-			return true
+		if rule.IsInhibit() {
+			continue
+		}
+		heatingStart := rule.HeatingStartTime(rule.WindowStartTime(now))
+		if !heatingStart.After(now) {
+			continue
+		}
+		lead := warmUpRate.LeadTime(referenceTemperature, rule.TargetTemp, maxLead)
+		if heatingStart.Sub(now) <= lead {
+			preheating = append(preheating, rule)
 		}
 	}
-	return false
+	return preheating
 }
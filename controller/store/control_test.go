@@ -228,6 +228,36 @@ func TestRuleTimingControllerMultipleRules(t *testing.T) {
 	}
 }
 
+func TestProfileSwitchControl(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testBoiler, err := testutils.CreateTestBoiler(ctx, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = testBoiler.SetProfile(ctx, "eco", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ProfileSwitchControl(ctx, testBoiler)
+	time.Sleep(SMALL_TIME)
+
+	_, err = testBoiler.ActivateProfile(ctx, "eco", time.Now().Add(HALF_TIME))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := testBoiler.GetInfo(ctx)
+	if info.ActiveProfile != model.DEFAULT_PROFILE {
+		t.Fatalf("Expected the switch to wait but profile %s is active", info.ActiveProfile)
+	}
+
+	time.Sleep(FULL_TIME)
+	info, _ = testBoiler.GetInfo(ctx)
+	if info.ActiveProfile != "eco" || info.ProfileSwitch != nil {
+		t.Fatalf("Expected the scheduled switch to eco but got %s %v", info.ActiveProfile, info.ProfileSwitch)
+	}
+}
+
 func TestRepeatingRuleNormalConditions(t *testing.T) {
 	ctx := context.Background()
 	testBoiler, err := testutils.CreateTestBoiler(ctx, t)
@@ -266,10 +296,25 @@ func TestRepeatingRuleNormalConditions(t *testing.T) {
 	}
 }
 
+// Checks run every millisecond, but how long each takes depends on the machine
+func waitForProtection(ctx context.Context, boiler *model.Boiler, active bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		info, err := boiler.GetInfo(ctx)
+		if err == nil && info.IsOverheatingProtectionActive == active {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
 func TestBoilerOverheatingControlBasic(t *testing.T) {
 	ctx := context.Background()
-	testRedis := testutils.CreateTestRedis()
-	testBoiler, err := testutils.CreateTestBoiler(ctx, t)
+	testStorage := testutils.CreateTestStorage()
+	testBoiler, err := testutils.CreateTestBoilerWithConfig(ctx, t, model.BoilerConfig{
+		Overheating: model.OverheatingSettings{CheckPeriodSeconds: 0.001},
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -277,8 +322,8 @@ func TestBoilerOverheatingControlBasic(t *testing.T) {
 	// Sneaky insert sample in the past (the boiler turned on 8 tau ago)
 	switchSeriesKey := "switch:" + "test_boiler_" + t.Name()
 	stateIndex := model.GetStateIndex(model.StateOn)
-	pastTimestamp := int(time.Now().Add(-model.OH_TAU * time.Second * 8).UnixMilli())
-	err = testRedis.TSAdd(ctx, switchSeriesKey, pastTimestamp, float64(stateIndex)).Err()
+	pastTimestamp := time.Now().Add(-model.OH_TAU * time.Second * 8).UnixMilli()
+	err = testStorage.TSAdd(ctx, switchSeriesKey, pastTimestamp, float64(stateIndex))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -291,32 +336,137 @@ func TestBoilerOverheatingControlBasic(t *testing.T) {
 	if info.IsOverheatingProtectionActive {
 		t.Fatal("Expected protection to be off but found active")
 	}
-	go BoilerOverheatingControl(ctx, testBoiler, time.Millisecond)
-	time.Sleep(2 * time.Millisecond)
+	controlCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go BoilerOverheatingControl(controlCtx, testBoiler)
 
-	info, err = testBoiler.GetInfo(ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if !info.IsOverheatingProtectionActive {
+	if !waitForProtection(ctx, testBoiler, true) {
 		t.Fatal("Expected protection to be on but found disabled")
 	}
 
 	// Sneaky insert sample in the past (the boiler turned off 3 tau ago)
 	stateIndex = model.GetStateIndex(model.StateOff)
-	pastTimestamp = int(time.Now().Add(-model.OH_TAU * time.Second * 3).UnixMilli())
-	err = testRedis.TSAdd(ctx, switchSeriesKey, pastTimestamp, float64(stateIndex)).Err()
+	pastTimestamp = time.Now().Add(-model.OH_TAU * time.Second * 3).UnixMilli()
+	err = testStorage.TSAdd(ctx, switchSeriesKey, pastTimestamp, float64(stateIndex))
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// Check
-	time.Sleep(2 * time.Millisecond)
-	info, err = testBoiler.GetInfo(ctx)
+	if !waitForProtection(ctx, testBoiler, false) {
+		t.Fatal("Expected protection to be off but found enabled")
+	}
+	// Every check is recorded
+	history, err := testBoiler.GetOverheatingIndexHistory(ctx, time.Now().Add(-time.Minute), time.Now())
 	if err != nil {
 		t.Fatal(err)
 	}
-	if info.IsOverheatingProtectionActive {
-		t.Fatal("Expected protection to be off but found enabled")
+	if len(history) == 0 {
+		t.Fatal("Expected the overheating index to be recorded")
+	}
+}
+
+func TestFailsafeDecision(t *testing.T) {
+	t0 := time.Date(2024, 1, 7, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name   string
+		config model.FailsafeConfig
+		after  time.Duration
+		want   model.State
+	}{
+		{"OFF by default", model.FailsafeConfig{}, 0, model.StateOff},
+		{"Frost duty ON", model.FailsafeConfig{DutyCycle: 0.25}, 10 * time.Minute, model.StateOn},
+		{"Frost duty OFF", model.FailsafeConfig{DutyCycle: 0.25}, 20 * time.Minute, model.StateOff},
+		{"Short cycle ON again", model.FailsafeConfig{DutyCycle: 0.5, CycleMinutes: 20}, 21 * time.Minute, model.StateOn},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			decision := failsafeDecision(tc.config, t0.Add(tc.after))
+			if decision.State != tc.want {
+				t.Fatalf("Wanted %s but got %s (%s)", tc.want, decision.State, decision.Reason)
+			}
+		})
+	}
+}
+
+func TestFrostProtectionDecision(t *testing.T) {
+	cold, warm := 3.0, 18.0
+	off := ControlDecision{model.StateOff, "no active rules"}
+	on := ControlDecision{model.StateOn, "below target"}
+	testCases := []struct {
+		name        string
+		decision    ControlDecision
+		temperature *float64
+		overheating bool
+		want        model.State
+		wantFrost   bool
+	}{
+		{"Warm enough", off, &warm, false, model.StateOff, false},
+		{"Below the floor without rules", off, &cold, false, model.StateOn, true},
+		{"Already heating", on, &cold, false, model.StateOn, false},
+		{"Overheating protection wins", off, &cold, true, model.StateOff, false},
+		{"No temperature to trust", off, nil, false, model.StateOff, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			decision, frost := frostProtectionDecision(tc.decision, tc.temperature, model.DEFAULT_FROST_TEMPERATURE, tc.overheating)
+			if decision.State != tc.want || frost != tc.wantFrost {
+				t.Fatalf("Wanted %s (frost %v) but got %s (frost %v, %s)", tc.want, tc.wantFrost, decision.State, frost, decision.Reason)
+			}
+		})
+	}
+}
+
+func TestControlRefresh(t *testing.T) {
+	now := time.Date(2024, 1, 7, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name string
+		info *model.BoilerInfo
+		want time.Duration
+	}{
+		{"Nothing ending", &model.BoilerInfo{}, CONTROL_REFRESH_PERIOD},
+		{"Boost ending soon", &model.BoilerInfo{Boost: &model.Boost{Start: now, End: now.Add(time.Second)}}, time.Second},
+		{"Boost already over", &model.BoilerInfo{Boost: &model.Boost{Start: now.Add(-time.Hour), End: now.Add(-time.Second)}}, 0},
+		{"Away ending later", &model.BoilerInfo{Away: &model.AwayMode{Start: now, End: now.Add(time.Hour)}}, CONTROL_REFRESH_PERIOD},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if refresh := controlRefresh(tc.info, now); refresh != tc.want {
+				t.Fatalf("Wanted %s but got %s", tc.want, refresh)
+			}
+		})
+	}
+}
+
+func TestRelayFault(t *testing.T) {
+	t0 := time.Date(2024, 1, 7, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name      string
+		commanded model.State
+		actual    model.State
+		since     *time.Time
+		now       time.Time
+		wantSince *time.Time
+		wantFault bool
+	}{
+		{"Relay follows", model.StateOn, model.StateOn, nil, t0, nil, false},
+		{"Nothing commanded yet", model.StateUnknown, model.StateOff, nil, t0, nil, false},
+		{"Mismatch starts", model.StateOn, model.StateOff, nil, t0, &t0, false},
+		{"Never acknowledged", model.StateOff, model.StateUnknown, nil, t0, &t0, false},
+		{"Mismatch within timeout", model.StateOn, model.StateOff, &t0, t0.Add(model.RELAY_ACK_TIMEOUT - time.Second), &t0, false},
+		{"Mismatch past timeout", model.StateOn, model.StateOff, &t0, t0.Add(model.RELAY_ACK_TIMEOUT), &t0, true},
+		{"Relay catches up", model.StateOn, model.StateOn, &t0, t0.Add(time.Hour), nil, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info := &model.BoilerInfo{CommandedState: tc.commanded, ActualState: tc.actual}
+			since, fault := relayFault(info, tc.since, tc.now)
+			if fault != tc.wantFault {
+				t.Fatalf("Expected fault to be %v but got %v", tc.wantFault, fault)
+			}
+			if (since == nil) != (tc.wantSince == nil) || (since != nil && !since.Equal(*tc.wantSince)) {
+				t.Fatalf("Expected mismatch since %v but got %v", tc.wantSince, since)
+			}
+		})
 	}
 }
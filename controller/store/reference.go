@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/storage"
+	"time"
+)
+
+const (
+	MeanFusion   = "mean"
+	MinFusion    = "min"
+	MaxFusion    = "max"
+	MedianFusion = "median"
+
+	REFERENCE_SENSOR_NAME    = "riferimento" // The reference of a boiler is recorded as sensor "riferimento:<boiler>"
+	REFERENCE_AVERAGE_PERIOD = 10 * time.Minute
+)
+
+type weightedSensor struct {
+	sensor *model.Sensor
+	weight float64
+}
+
+// Combines the control sensors of a boiler into the temperature the control
+// acts on, and records it.
+type ReferenceTemperature struct {
+	Sensor  *model.Sensor // Where the reference is recorded
+	sensors []weightedSensor
+	fusion  string
+}
+
+func NewReferenceTemperature(ctx context.Context, client storage.Storage, config model.BoilerConfig, sensors map[string]*model.Sensor) (*ReferenceTemperature, error) {
+	reference := &ReferenceTemperature{fusion: config.Fusion}
+	switch reference.fusion {
+	case "":
+		reference.fusion = MeanFusion
+	case MeanFusion, MinFusion, MaxFusion, MedianFusion:
+	default:
+		return nil, fmt.Errorf("unknown sensor fusion: %s", config.Fusion)
+	}
+
+	controlSensors := config.Sensors
+	if len(controlSensors) == 0 {
+		controlSensors = []model.ControlSensor{{Id: config.Sensor}}
+	}
+	for _, controlSensor := range controlSensors {
+		sensor, ok := sensors[controlSensor.Id]
+		if !ok {
+			return nil, fmt.Errorf("boiler '%s' is controlled by unknown sensor '%s'", config.Name, controlSensor.Id)
+		}
+		weight := controlSensor.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("sensor '%s' weight must be positive", controlSensor.Id)
+		}
+		reference.sensors = append(reference.sensors, weightedSensor{sensor, weight})
+	}
+
+	var err error
+	reference.Sensor, err = model.NewSensor(ctx, client, &model.SensorOptions{Name: REFERENCE_SENSOR_NAME, Position: config.Name})
+	return reference, err
+}
+
+func (r *ReferenceTemperature) String() string {
+	ids := make([]string, len(r.sensors))
+	for i, input := range r.sensors {
+		ids[i] = input.sensor.Id
+	}
+	return fmt.Sprintf("%s of %s", r.fusion, strings.Join(ids, ", "))
+}
+
+// Updates from any of the control sensors
+func (r *ReferenceTemperature) Listen(ctx context.Context) (<-chan *model.Measure, error) {
+	updates := make(chan *model.Measure)
+	listeners := make([]<-chan *model.Measure, len(r.sensors))
+	for i, input := range r.sensors {
+		listener, err := input.sensor.Listen(ctx)
+		if err != nil {
+			return nil, err
+		}
+		listeners[i] = listener
+	}
+	closed := make(chan struct{}, len(listeners))
+	for _, listener := range listeners {
+		go func() {
+			defer func() { closed <- struct{}{} }()
+			for measure := range listener {
+				select {
+				case updates <- measure:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	// Closes once every sensor is gone
+	go func() {
+		for range listeners {
+			<-closed
+		}
+		close(updates)
+	}()
+	return updates, nil
+}
+
+// Fuses the sensors that are not stale and records the result. Returns nil
+// when every sensor is stale.
+func (r *ReferenceTemperature) Update(ctx context.Context, now time.Time) (*float64, error) {
+	values := []float64{}
+	weights := []float64{}
+	for _, input := range r.sensors {
+		latest, err := input.sensor.GetLatest(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not get latest sample of sensor '%s': %w", input.sensor.Id, err)
+		}
+		if input.sensor.IsStale(latest, now) {
+			continue
+		}
+		// Smooth with the recent average, the latest sample if we don't have one yet
+		average, err := input.sensor.GetAverage(ctx, now.Add(-REFERENCE_AVERAGE_PERIOD), now)
+		if err != nil {
+			return nil, fmt.Errorf("could not get average temperature for sensor '%s': %w", input.sensor.Id, err)
+		}
+		value := latest.Value
+		if average != nil {
+			value = *average
+		}
+		values = append(values, value)
+		weights = append(weights, input.weight)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	reference := fuse(values, weights, r.fusion)
+	err := r.Sensor.AddSample(ctx, &model.Measure{Value: reference, Time: now})
+	if err != nil {
+		return nil, fmt.Errorf("could not record reference temperature: %w", err)
+	}
+	return &reference, nil
+}
+
+func fuse(values []float64, weights []float64, fusion string) float64 {
+	switch fusion {
+	case MinFusion:
+		return slices.Min(values)
+	case MaxFusion:
+		return slices.Max(values)
+	case MedianFusion:
+		sorted := slices.Clone(values)
+		slices.Sort(sorted)
+		middle := len(sorted) / 2
+		if len(sorted)%2 == 0 {
+			return (sorted[middle-1] + sorted[middle]) / 2
+		}
+		return sorted[middle]
+	default:
+		sum, totalWeight := 0.0, 0.0
+		for i, value := range values {
+			sum += value * weights[i]
+			totalWeight += weights[i]
+		}
+		return sum / totalWeight
+	}
+}
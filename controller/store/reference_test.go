@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/testutils"
+)
+
+func createTestSensor(ctx context.Context, t *testing.T, name string) *model.Sensor {
+	client := testutils.CreateTestStorage()
+	position := "test_" + t.Name()
+	err := client.Del(ctx, name+":"+position, name+"_compacted:"+position)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor, err := model.NewSensor(ctx, client, &model.SensorOptions{Name: name, Position: position, StaleAfterSeconds: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sensor
+}
+
+func TestFuse(t *testing.T) {
+	values := []float64{18, 20, 21}
+	weights := []float64{2, 1, 1}
+	testCases := []struct {
+		fusion string
+		want   float64
+	}{
+		{MeanFusion, 19.25},
+		{MinFusion, 18},
+		{MaxFusion, 21},
+		{MedianFusion, 20},
+	}
+	for _, tc := range testCases {
+		got := fuse(values, weights, tc.fusion)
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Fatalf("%s: wanted %.2f but got %.2f", tc.fusion, tc.want, got)
+		}
+	}
+	if got := fuse([]float64{18, 20}, []float64{1, 1}, MedianFusion); got != 19 {
+		t.Fatalf("Expected median of an even count to be the middle average but got %.2f", got)
+	}
+}
+
+func TestReferenceTemperatureUpdate(t *testing.T) {
+	ctx := context.Background()
+	client := testutils.CreateTestStorage()
+	living := createTestSensor(ctx, t, "soggiorno")
+	bedroom := createTestSensor(ctx, t, "camera")
+	sensors := map[string]*model.Sensor{living.Id: living, bedroom.Id: bedroom}
+	config := model.BoilerConfig{
+		Name:    "test_boiler_" + t.Name(),
+		Sensors: []model.ControlSensor{{Id: living.Id, Weight: 3}, {Id: bedroom.Id}},
+	}
+	err := client.Del(ctx, REFERENCE_SENSOR_NAME+":"+config.Name, REFERENCE_SENSOR_NAME+"_compacted:"+config.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reference, err := NewReferenceTemperature(ctx, client, config, sensors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing heard yet
+	now := time.Now().Add(-3 * time.Minute)
+	value, err := reference.Update(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != nil {
+		t.Fatalf("Expected no reference without samples but got %.2f", *value)
+	}
+
+	// Both alive, weighted mean
+	living.AddSample(ctx, &model.Measure{Value: 20, Time: now.Add(-10 * time.Second)})
+	bedroom.AddSample(ctx, &model.Measure{Value: 16, Time: now.Add(-10 * time.Second)})
+	value, err = reference.Update(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value == nil || *value != 19 {
+		t.Fatalf("Expected weighted mean of 19°C but got %v", value)
+	}
+
+	// The living room goes silent and is left out
+	later := now.Add(2 * time.Minute)
+	bedroom.AddSample(ctx, &model.Measure{Value: 16, Time: later.Add(-10 * time.Second)})
+	value, err = reference.Update(ctx, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value == nil || *value != 16 {
+		t.Fatalf("Expected only the bedroom at 16°C but got %v", value)
+	}
+
+	// What the control acted on is recorded
+	latest, err := reference.Sensor.GetLatest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest == nil || latest.Value != 16 || !latest.Time.Equal(later.Truncate(time.Millisecond)) {
+		t.Fatalf("Expected the reference to be recorded but got %v", latest)
+	}
+}
+
+func TestNewReferenceTemperatureValidation(t *testing.T) {
+	ctx := context.Background()
+	client := testutils.CreateTestStorage()
+	sensor := createTestSensor(ctx, t, "soggiorno")
+	sensors := map[string]*model.Sensor{sensor.Id: sensor}
+	testCases := []struct {
+		name   string
+		config model.BoilerConfig
+	}{
+		{"Unknown fusion", model.BoilerConfig{Sensor: sensor.Id, Fusion: "magic"}},
+		{"Unknown sensor", model.BoilerConfig{Sensor: "temperatura:soffitta"}},
+		{"Negative weight", model.BoilerConfig{Sensors: []model.ControlSensor{{Id: sensor.Id, Weight: -1}}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewReferenceTemperature(ctx, client, tc.config, sensors)
+			if err == nil {
+				t.Fatal("Expected an error but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"fmt"
+	"stupid-caldaia/controller/graph/model"
+	"time"
+)
+
+const (
+	ThresholdStrategy  = "threshold"
+	HysteresisStrategy = "hysteresis"
+	PIStrategy         = "pi"
+
+	defaultHysteresisMargin = 0.2  // In °C
+	defaultPIKp             = 0.5  // Duty cycle per °C of error
+	defaultPIKi             = 0.01 // Duty cycle per °C of error per minute
+	defaultPICycleSeconds   = 10 * 60
+)
+
+// Everything a strategy may need to take a decision
+type ControlInput struct {
+	Now                           time.Time
+	Rules                         []*model.Rule // Only the ones currently in control (active and not delayed), the control loop passes the one with the highest priority
+	ReferenceTemperature          float64
+	TemperatureHistory            []*model.Measure
+	SwitchHistory                 []*model.SwitchSample
+	IsOverheatingProtectionActive bool
+}
+
+type ControlDecision struct {
+	State  model.State
+	Reason string
+}
+
+// Strategies may keep state between calls, a new one is needed for every
+// control loop.
+type ControlStrategy interface {
+	Decide(input *ControlInput) ControlDecision
+}
+
+func NewControlStrategy(config model.ControlConfig) (ControlStrategy, error) {
+	switch config.Strategy {
+	case ThresholdStrategy, "":
+		return &thresholdStrategy{}, nil
+	case HysteresisStrategy:
+		strategy := &hysteresisStrategy{lower: config.LowerMargin, upper: config.UpperMargin}
+		if strategy.lower == 0 && strategy.upper == 0 {
+			strategy.lower = defaultHysteresisMargin
+			strategy.upper = defaultHysteresisMargin
+		}
+		if strategy.lower < 0 || strategy.upper < 0 {
+			return nil, fmt.Errorf("hysteresis margins must be positive")
+		}
+		return strategy, nil
+	case PIStrategy:
+		strategy := &piStrategy{
+			kp:          config.Kp,
+			ki:          config.Ki,
+			cyclePeriod: time.Duration(config.CycleSeconds) * time.Second,
+		}
+		if strategy.kp == 0 && strategy.ki == 0 {
+			strategy.kp = defaultPIKp
+			strategy.ki = defaultPIKi
+		}
+		if strategy.cyclePeriod == 0 {
+			strategy.cyclePeriod = defaultPICycleSeconds * time.Second
+		}
+		if strategy.kp < 0 || strategy.ki < 0 || strategy.cyclePeriod < 0 {
+			return nil, fmt.Errorf("PI gains and cycle period must be positive")
+		}
+		return strategy, nil
+	default:
+		return nil, fmt.Errorf("unknown control strategy: %s", config.Strategy)
+	}
+}
+
+// The rule asking for the highest temperature is the one to satisfy
+func highestTargetRule(rules []*model.Rule) *model.Rule {
+	var highest *model.Rule
+	for _, rule := range rules {
+		if highest == nil || rule.TargetTemp > highest.TargetTemp {
+			highest = rule
+		}
+	}
+	return highest
+}
+
+// Plain bang-bang: heat whenever we are below any target
+type thresholdStrategy struct{}
+
+func (s *thresholdStrategy) Decide(input *ControlInput) ControlDecision {
+	if input.IsOverheatingProtectionActive {
+		return ControlDecision{model.StateOff, "overheating protection active"}
+	}
+	rule := highestTargetRule(input.Rules)
+	if rule == nil {
+		return ControlDecision{model.StateOff, "no active rules"}
+	}
+	if input.ReferenceTemperature < rule.TargetTemp {
+		return ControlDecision{model.StateOn, fmt.Sprintf("%.1f°C below target %.1f°C of rule %s", input.ReferenceTemperature, rule.TargetTemp, rule.ID)}
+	}
+	return ControlDecision{model.StateOff, fmt.Sprintf("%.1f°C reached target %.1f°C of rule %s", input.ReferenceTemperature, rule.TargetTemp, rule.ID)}
+}
+
+// Starts heating below target - lower margin and stops above target + upper
+// margin. Rules can override the boiler margins. In between it keeps doing
+// whatever it was doing.
+type hysteresisStrategy struct {
+	lower       float64
+	upper       float64
+	heating     bool
+	initialised bool
+}
+
+func (s *hysteresisStrategy) Decide(input *ControlInput) ControlDecision {
+	if !s.initialised {
+		// Pick up the phase the boiler is in, it may have been heating before a restart
+		if count := len(input.SwitchHistory); count > 0 {
+			s.heating = input.SwitchHistory[count-1].State == model.StateOn
+		}
+		s.initialised = true
+	}
+	if input.IsOverheatingProtectionActive {
+		s.heating = false
+		return ControlDecision{model.StateOff, "overheating protection active"}
+	}
+	if len(input.Rules) == 0 {
+		s.heating = false
+		return ControlDecision{model.StateOff, "no active rules"}
+	}
+
+	// Heat while any rule wants it, either to start or to keep going
+	var inControl *model.Rule
+	for _, rule := range input.Rules {
+		lower, upper := s.margins(rule)
+		threshold := rule.TargetTemp - lower
+		if s.heating {
+			threshold = rule.TargetTemp + upper
+		}
+		if input.ReferenceTemperature < threshold {
+			inControl = rule
+			break
+		}
+	}
+	s.heating = inControl != nil
+	if s.heating {
+		_, upper := s.margins(inControl)
+		return ControlDecision{model.StateOn, fmt.Sprintf("%.1f°C heating up to %.1f°C for rule %s", input.ReferenceTemperature, inControl.TargetTemp+upper, inControl.ID)}
+	}
+	rule := highestTargetRule(input.Rules)
+	lower, _ := s.margins(rule)
+	return ControlDecision{model.StateOff, fmt.Sprintf("%.1f°C idle until below %.1f°C for rule %s", input.ReferenceTemperature, rule.TargetTemp-lower, rule.ID)}
+}
+
+func (s *hysteresisStrategy) margins(rule *model.Rule) (float64, float64) {
+	lower, upper := s.lower, s.upper
+	if rule.HysteresisLower != nil {
+		lower = *rule.HysteresisLower
+	}
+	if rule.HysteresisUpper != nil {
+		upper = *rule.HysteresisUpper
+	}
+	return lower, upper
+}
+
+// Time-proportional control: a PI controller sets the duty cycle, the boiler
+// stays ON for that fraction of every cycle. The duty is only updated at the
+// start of a cycle so the relay switches at most twice per cycle.
+type piStrategy struct {
+	kp          float64
+	ki          float64
+	cyclePeriod time.Duration
+	integral    float64 // In °C * minutes
+	lastTime    time.Time
+	cycleStart  time.Time
+	duty        float64
+}
+
+func (s *piStrategy) Decide(input *ControlInput) ControlDecision {
+	rule := highestTargetRule(input.Rules)
+	if rule == nil {
+		s.reset()
+		return ControlDecision{model.StateOff, "no active rules"}
+	}
+	tempError := rule.TargetTemp - input.ReferenceTemperature
+
+	// Integrate the error, not while protected as we couldn't act anyway
+	if !s.lastTime.IsZero() && !input.IsOverheatingProtectionActive {
+		elapsed := min(input.Now.Sub(s.lastTime), s.cyclePeriod)
+		s.integral += tempError * elapsed.Minutes()
+		// Anti-windup, the integral alone can't ask for more than 100%
+		if s.ki > 0 {
+			s.integral = clamp(s.integral, 0, 1/s.ki)
+		}
+	}
+	s.lastTime = input.Now
+
+	if s.cycleStart.IsZero() || input.Now.Sub(s.cycleStart) >= s.cyclePeriod {
+		s.cycleStart = input.Now
+		s.duty = clamp(s.kp*tempError+s.ki*s.integral, 0, 1)
+	}
+
+	if input.IsOverheatingProtectionActive {
+		return ControlDecision{model.StateOff, "overheating protection active"}
+	}
+	onUntil := s.cycleStart.Add(time.Duration(s.duty * float64(s.cyclePeriod)))
+	if input.Now.Before(onUntil) {
+		return ControlDecision{model.StateOn, fmt.Sprintf("PI duty %.0f%% for rule %s, ON until %s", s.duty*100, rule.ID, onUntil.Format("15:04:05"))}
+	}
+	return ControlDecision{model.StateOff, fmt.Sprintf("PI duty %.0f%% for rule %s, OFF until %s", s.duty*100, rule.ID, s.cycleStart.Add(s.cyclePeriod).Format("15:04:05"))}
+}
+
+func (s *piStrategy) reset() {
+	s.integral = 0
+	s.lastTime = time.Time{}
+	s.cycleStart = time.Time{}
+	s.duty = 0
+}
+
+func clamp(value float64, low float64, high float64) float64 {
+	return max(low, min(value, high))
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"stupid-caldaia/controller/graph/model"
+)
+
+type strategyStep struct {
+	after       time.Duration // Since the first step
+	temperature float64
+	want        model.State
+}
+
+func runStrategySteps(t *testing.T, strategy ControlStrategy, rules []*model.Rule, steps []strategyStep) {
+	t0 := time.Date(2024, 1, 7, 12, 0, 0, 0, time.Local)
+	for i, step := range steps {
+		decision := strategy.Decide(&ControlInput{
+			Now:                  t0.Add(step.after),
+			Rules:                rules,
+			ReferenceTemperature: step.temperature,
+		})
+		if decision.State != step.want {
+			t.Fatalf("Step %d at %.1f°C: wanted %s but got %s (%s)", i, step.temperature, step.want, decision.State, decision.Reason)
+		}
+	}
+}
+
+func TestNewControlStrategy(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  model.ControlConfig
+		wantErr bool
+	}{
+		{name: "Default", config: model.ControlConfig{}},
+		{name: "Hysteresis", config: model.ControlConfig{Strategy: HysteresisStrategy, LowerMargin: 0.5, UpperMargin: 0.2}},
+		{name: "Hysteresis negative margin", config: model.ControlConfig{Strategy: HysteresisStrategy, UpperMargin: -1}, wantErr: true},
+		{name: "PI", config: model.ControlConfig{Strategy: PIStrategy}},
+		{name: "PI negative gain", config: model.ControlConfig{Strategy: PIStrategy, Kp: -1}, wantErr: true},
+		{name: "Unknown", config: model.ControlConfig{Strategy: "magic"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewControlStrategy(tc.config)
+			if tc.wantErr && err == nil {
+				t.Fatal("Expected an error but got none")
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestThresholdStrategy(t *testing.T) {
+	rules := []*model.Rule{{ID: "low", TargetTemp: 18}, {ID: "high", TargetTemp: 20}}
+	runStrategySteps(t, &thresholdStrategy{}, rules, []strategyStep{
+		{0, 17, model.StateOn},
+		{time.Minute, 19, model.StateOn},
+		{2 * time.Minute, 20, model.StateOff},
+		{3 * time.Minute, 19.9, model.StateOn},
+	})
+	runStrategySteps(t, &thresholdStrategy{}, nil, []strategyStep{
+		{0, 5, model.StateOff},
+	})
+
+	decision := (&thresholdStrategy{}).Decide(&ControlInput{
+		Rules:                         rules,
+		ReferenceTemperature:          10,
+		IsOverheatingProtectionActive: true,
+	})
+	if decision.State != model.StateOff {
+		t.Fatal("Expected OFF while protected")
+	}
+}
+
+func TestHysteresisStrategy(t *testing.T) {
+	rules := []*model.Rule{{ID: "rule", TargetTemp: 20}}
+	runStrategySteps(t, &hysteresisStrategy{lower: 0.5, upper: 0.3}, rules, []strategyStep{
+		{0, 19.8, model.StateOff}, // Inside the band, not heating yet
+		{time.Minute, 19.4, model.StateOn},
+		{2 * time.Minute, 20.2, model.StateOn}, // Keeps heating above target
+		{3 * time.Minute, 20.3, model.StateOff},
+		{4 * time.Minute, 19.8, model.StateOff}, // Keeps idling below target
+		{5 * time.Minute, 19.4, model.StateOn},
+	})
+}
+
+func TestHysteresisStrategyRuleOverride(t *testing.T) {
+	zero := 0.0
+	wide := 2.0
+	rules := []*model.Rule{{ID: "rule", TargetTemp: 20, HysteresisLower: &wide, HysteresisUpper: &zero}}
+	runStrategySteps(t, &hysteresisStrategy{lower: 0.5, upper: 0.5}, rules, []strategyStep{
+		{0, 19, model.StateOff},
+		{time.Minute, 17.9, model.StateOn},
+		{2 * time.Minute, 19.9, model.StateOn},
+		{3 * time.Minute, 20, model.StateOff},
+	})
+}
+
+func TestHysteresisStrategyResumesPhase(t *testing.T) {
+	strategy := &hysteresisStrategy{lower: 0.5, upper: 0.5}
+	decision := strategy.Decide(&ControlInput{
+		Rules:                []*model.Rule{{ID: "rule", TargetTemp: 20}},
+		ReferenceTemperature: 20.2,
+		SwitchHistory:        []*model.SwitchSample{{State: model.StateOff}, {State: model.StateOn}},
+	})
+	if decision.State != model.StateOn {
+		t.Fatalf("Expected to keep heating after a restart but got %s (%s)", decision.State, decision.Reason)
+	}
+}
+
+func TestPIStrategy(t *testing.T) {
+	rules := []*model.Rule{{ID: "rule", TargetTemp: 20}}
+	strategy := func() ControlStrategy {
+		return &piStrategy{kp: 0.5, ki: 0, cyclePeriod: 10 * time.Minute}
+	}
+
+	// 1°C below target is 50% duty: 5 minutes ON and 5 minutes OFF
+	runStrategySteps(t, strategy(), rules, []strategyStep{
+		{0, 19, model.StateOn},
+		{4 * time.Minute, 19, model.StateOn},
+		{6 * time.Minute, 19, model.StateOff},
+		{9 * time.Minute, 19, model.StateOff},
+		{10 * time.Minute, 19, model.StateOn},
+	})
+
+	// Far below target is always ON, above target always OFF
+	runStrategySteps(t, strategy(), rules, []strategyStep{
+		{0, 15, model.StateOn},
+		{9 * time.Minute, 15, model.StateOn},
+		{10 * time.Minute, 21, model.StateOff},
+		{15 * time.Minute, 21, model.StateOff},
+	})
+
+	// The integral keeps pushing when a small error persists
+	integral := &piStrategy{kp: 0, ki: 0.1, cyclePeriod: 10 * time.Minute}
+	runStrategySteps(t, integral, rules, []strategyStep{
+		{0, 19, model.StateOff},
+		{5 * time.Minute, 19, model.StateOff},
+		{10 * time.Minute, 19, model.StateOn},
+	})
+}
+
+func TestPreheatingRules(t *testing.T) {
+	now := time.Now()
+	warmUpRate := &model.WarmUpRate{Intercept: 2} // 2°C per hour
+	rules := []*model.Rule{
+		{ID: "soon", Start: now.Add(20 * time.Minute), Duration: time.Hour, TargetTemp: 20},
+		{ID: "later", Start: now.Add(3 * time.Hour), Duration: time.Hour, TargetTemp: 20},
+		{ID: "delayed", Start: now.Add(-time.Minute), Delay: 10 * time.Minute, Duration: time.Hour, TargetTemp: 20},
+		{ID: "running", Start: now.Add(-time.Minute), Duration: time.Hour, TargetTemp: 20},
+		{ID: "warm enough", Start: now.Add(20 * time.Minute), Duration: time.Hour, TargetTemp: 19},
+	}
+	got := preheatingRules(rules, 19, warmUpRate, 2*time.Hour, now)
+	if len(got) != 2 || got[0].ID != "soon" || got[1].ID != "delayed" {
+		t.Fatalf("Expected 'soon' and 'delayed' to preheat but got %v", got)
+	}
+	if preheatingRules(rules, 19, nil, 2*time.Hour, now) != nil {
+		t.Fatal("Expected no preheating without a warm up rate")
+	}
+}
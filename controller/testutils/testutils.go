@@ -3,7 +3,11 @@ package testutils
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/storage"
+	"sync"
 	"testing"
 
 	"github.com/redis/go-redis/v9"
@@ -13,31 +17,69 @@ const (
 	MIN_TEMP    = 10
 	MAX_TEMP    = 20
 	LOCAL_REDIS = "localhost:6379"
+	// Set to "redis" to run the tests against LOCAL_REDIS or to "sqlite" to
+	// run them against a temporary database file instead of in memory
+	STORAGE_ENV_VAR = "TEST_STORAGE"
 )
 
-func CreateTestRedis() *redis.Client {
-	return redis.NewClient(&redis.Options{Addr: LOCAL_REDIS})
+var (
+	// Shared like a real database would be, so tests can sneak samples in
+	memoryStorage = storage.NewMemory()
+	sqliteStorage *storage.SQLite
+	sqliteOnce    sync.Once
+)
+
+func CreateTestStorage() storage.Storage {
+	switch os.Getenv(STORAGE_ENV_VAR) {
+	case "redis":
+		return storage.NewRedis(redis.NewClient(&redis.Options{Addr: LOCAL_REDIS}))
+	case "sqlite":
+		sqliteOnce.Do(func() {
+			var err error
+			sqliteStorage, err = storage.NewSQLite(filepath.Join(os.TempDir(), fmt.Sprintf("stupid-caldaia-test-%d.db", os.Getpid())))
+			if err != nil {
+				panic(err)
+			}
+		})
+		return sqliteStorage
+	default:
+		return memoryStorage
+	}
 }
 
 func CreateTestBoiler(ctx context.Context, t *testing.T) (*model.Boiler, error) {
+	return CreateTestBoilerWithConfig(ctx, t, model.BoilerConfig{})
+}
+
+// Name, temperatures and pin are always set for the test, anything else in
+// config is kept
+func CreateTestBoilerWithConfig(ctx context.Context, t *testing.T, config model.BoilerConfig) (*model.Boiler, error) {
 	// Make sure we clean up before creating a new boiler
-	client := CreateTestRedis()
+	client := CreateTestStorage()
 	err := client.Del(
 		ctx,
 		"test_boiler_"+t.Name(),
 		"switch:"+"test_boiler_"+t.Name(),
 		"overheating:"+"test_boiler_"+t.Name(),
-	).Err()
+		"warmup:"+"test_boiler_"+t.Name(),
+		"overheating-settings:"+"test_boiler_"+t.Name(),
+		"overheating-index:"+"test_boiler_"+t.Name(),
+		"heartbeat:controller:"+"test_boiler_"+t.Name(),
+		"heartbeat:worker:"+"test_boiler_"+t.Name(),
+		"relay-ack:"+"test_boiler_"+t.Name(),
+		"audit:"+"test_boiler_"+t.Name(),
+		"frost-protection:"+"test_boiler_"+t.Name(),
+		"rule-control:"+"test_boiler_"+t.Name(),
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	boiler, err := model.NewBoiler(ctx, client, model.BoilerConfig{
-		Name:                  fmt.Sprintf("test_boiler_%s", t.Name()),
-		DefaultMinTemperature: MIN_TEMP,
-		DefaultMaxTemperature: MAX_TEMP,
-		SwitchPin:             1,
-	})
+	config.Name = fmt.Sprintf("test_boiler_%s", t.Name())
+	config.DefaultMinTemperature = MIN_TEMP
+	config.DefaultMaxTemperature = MAX_TEMP
+	config.SwitchPin = 1
+	boiler, err := model.NewBoiler(ctx, client, config)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,317 @@
+// First order (RC) thermal model of the house heated by the boiler
+//
+//	dT/dt = -LossRate * (T - Tout) + HeatingRate * u + Offset
+//
+// where u is the fraction of time the boiler is ON. Without an outdoor sensor
+// Tout is taken as 0 and Offset absorbs LossRate * (average outdoor temperature).
+package thermal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/storage"
+)
+
+const (
+	maxSampleGap     = 15 * time.Minute // Longer gaps between samples are not used to fit
+	outdoorTolerance = 15 * time.Minute // How far an outdoor sample can be from an indoor one
+)
+
+type Model struct {
+	LossRate    float64 // 1/hour, share of the indoor-outdoor difference lost every hour
+	HeatingRate float64 // °C/hour added by the boiler when ON
+	Offset      float64 // °C/hour not explained by the boiler or the outdoor temperature
+	UsesOutdoor bool
+
+	// Only when the burner power is known
+	BoilerPower         float64 // kW
+	HeatLossCoefficient float64 // kW/°C
+	HeatCapacity        float64 // kWh/°C
+
+	Quality Quality
+	From    time.Time
+	To      time.Time
+}
+
+type Quality struct {
+	Samples int
+	R2      float64 // Of the fitted temperature derivative
+	RMSE    float64 // °C, of the temperature simulated from the first sample
+}
+
+// Time for the house to cover 63% of a temperature step
+func (m *Model) TimeConstant() time.Duration {
+	if m.LossRate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Hour) / m.LossRate)
+}
+
+// Temperature the house settles to with the boiler always ON (or OFF)
+func (m *Model) SteadyState(outdoor float64, on bool) float64 {
+	u := 0.0
+	if on {
+		u = 1
+	}
+	return outdoor + (m.HeatingRate*u+m.Offset)/m.LossRate
+}
+
+func (m *Model) String() string {
+	report := fmt.Sprintf("Loss rate: %.4f 1/h (time constant %s)\n", m.LossRate, m.TimeConstant().Round(time.Minute))
+	report += fmt.Sprintf("Boiler heat input: %.3f °C/h\n", m.HeatingRate)
+	if m.UsesOutdoor {
+		report += fmt.Sprintf("Other gains: %.3f °C/h\n", m.Offset)
+	} else {
+		report += fmt.Sprintf("Equivalent outdoor temperature: %.1f °C\n", m.Offset/m.LossRate)
+	}
+	if m.BoilerPower > 0 {
+		report += fmt.Sprintf("Heat loss coefficient: %.3f kW/°C\n", m.HeatLossCoefficient)
+		report += fmt.Sprintf("Heat capacity: %.2f kWh/°C\n", m.HeatCapacity)
+	}
+	report += fmt.Sprintf("Fit on %d samples: R² %.3f, simulation RMSE %.2f °C", m.Quality.Samples, m.Quality.R2, m.Quality.RMSE)
+	return report
+}
+
+// One step of the recorded history
+type point struct {
+	time        time.Time
+	temperature float64
+	outdoor     float64
+	on          float64 // Share of the step the boiler was ON
+	step        time.Duration
+	next        float64 // Temperature at the end of the step
+	contiguous  bool    // Follows the previous point without gaps
+}
+
+// Fits the model on indoor temperature, switch history and, if not nil,
+// outdoor temperature. boilerPower in kW is optional (0 if unknown).
+func Fit(indoor []*model.Measure, switches []*model.SwitchSample, outdoor []*model.Measure, boilerPower float64) (*Model, error) {
+	points := buildPoints(indoor, switches, outdoor)
+	if len(points) < 10 {
+		return nil, fmt.Errorf("not enough samples to fit a model, got %d", len(points))
+	}
+
+	// Least squares on the temperature derivative
+	usesOutdoor := outdoor != nil
+	features := make([][]float64, len(points))
+	targets := make([]float64, len(points))
+	for i, p := range points {
+		features[i] = []float64{-(p.temperature - p.outdoor), p.on, 1}
+		targets[i] = (p.next - p.temperature) / p.step.Hours()
+	}
+	coefficients, err := leastSquares(features, targets)
+	if err != nil {
+		return nil, err
+	}
+	m := &Model{
+		LossRate:    coefficients[0],
+		HeatingRate: coefficients[1],
+		Offset:      coefficients[2],
+		UsesOutdoor: usesOutdoor,
+		From:        points[0].time,
+		To:          points[len(points)-1].time.Add(points[len(points)-1].step),
+	}
+	if m.LossRate <= 0 || m.HeatingRate <= 0 {
+		return m, fmt.Errorf("fitted model is not physical (loss rate %.4f, heating rate %.4f), is there enough heating in the range?", m.LossRate, m.HeatingRate)
+	}
+	if boilerPower > 0 {
+		m.BoilerPower = boilerPower
+		m.HeatCapacity = boilerPower / m.HeatingRate
+		m.HeatLossCoefficient = m.LossRate * m.HeatCapacity
+	}
+	m.Quality = quality(m, points, features, targets)
+	return m, nil
+}
+
+func buildPoints(indoor []*model.Measure, switches []*model.SwitchSample, outdoor []*model.Measure) []point {
+	points := []point{}
+	for i := 0; i < len(indoor)-1; i++ {
+		start, end := indoor[i], indoor[i+1]
+		step := end.Time.Sub(start.Time)
+		if step <= 0 || step > maxSampleGap {
+			continue
+		}
+		outdoorTemperature := 0.0
+		if outdoor != nil {
+			closest, ok := closestMeasure(outdoor, start.Time)
+			if !ok {
+				continue
+			}
+			outdoorTemperature = closest
+		}
+		contiguous := len(points) > 0 && points[len(points)-1].time.Add(points[len(points)-1].step).Equal(start.Time)
+		points = append(points, point{
+			time:        start.Time,
+			temperature: start.Value,
+			outdoor:     outdoorTemperature,
+			on:          onShare(switches, start.Time, end.Time),
+			step:        step,
+			next:        end.Value,
+			contiguous:  contiguous,
+		})
+	}
+	return points
+}
+
+// Share of the interval the boiler spent ON, switches must be sorted by time
+func onShare(switches []*model.SwitchSample, from time.Time, to time.Time) float64 {
+	onTime := time.Duration(0)
+	for i, sample := range switches {
+		if sample.State != model.StateOn {
+			continue
+		}
+		sampleEnd := to
+		if i < len(switches)-1 {
+			sampleEnd = switches[i+1].Time
+		}
+		start := maxTime(sample.Time, from)
+		end := minTime(sampleEnd, to)
+		if end.After(start) {
+			onTime += end.Sub(start)
+		}
+	}
+	return onTime.Seconds() / to.Sub(from).Seconds()
+}
+
+func closestMeasure(measures []*model.Measure, t time.Time) (float64, bool) {
+	var closest *model.Measure
+	for _, measure := range measures {
+		if closest == nil || measure.Time.Sub(t).Abs() < closest.Time.Sub(t).Abs() {
+			closest = measure
+		}
+	}
+	if closest == nil || closest.Time.Sub(t).Abs() > outdoorTolerance {
+		return 0, false
+	}
+	return closest.Value, true
+}
+
+func quality(m *Model, points []point, features [][]float64, targets []float64) Quality {
+	coefficients := []float64{m.LossRate, m.HeatingRate, m.Offset}
+	mean := 0.0
+	for _, target := range targets {
+		mean += target / float64(len(targets))
+	}
+	residuals, total := 0.0, 0.0
+	for i, feature := range features {
+		predicted := 0.0
+		for j := range feature {
+			predicted += feature[j] * coefficients[j]
+		}
+		residuals += math.Pow(targets[i]-predicted, 2)
+		total += math.Pow(targets[i]-mean, 2)
+	}
+	r2 := 0.0
+	if total > 0 {
+		r2 = 1 - residuals/total
+	}
+
+	// Simulate, restarting from the measure after every gap
+	simulated := points[0].temperature
+	squaredError := 0.0
+	for i, p := range points {
+		if !p.contiguous && i > 0 {
+			simulated = p.temperature
+		}
+		derivative := -m.LossRate*(simulated-p.outdoor) + m.HeatingRate*p.on + m.Offset
+		simulated += derivative * p.step.Hours()
+		squaredError += math.Pow(simulated-p.next, 2)
+	}
+	return Quality{
+		Samples: len(points),
+		R2:      r2,
+		RMSE:    math.Sqrt(squaredError / float64(len(points))),
+	}
+}
+
+// Solves the normal equations with gaussian elimination, fine for a handful
+// of coefficients
+func leastSquares(features [][]float64, targets []float64) ([]float64, error) {
+	size := len(features[0])
+	matrix := make([][]float64, size)
+	for i := range matrix {
+		matrix[i] = make([]float64, size+1)
+	}
+	for k, feature := range features {
+		for i := 0; i < size; i++ {
+			for j := 0; j < size; j++ {
+				matrix[i][j] += feature[i] * feature[j]
+			}
+			matrix[i][size] += feature[i] * targets[k]
+		}
+	}
+
+	for col := 0; col < size; col++ {
+		pivot := col
+		for row := col + 1; row < size; row++ {
+			if math.Abs(matrix[row][col]) > math.Abs(matrix[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(matrix[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("cannot fit model, history doesn't have enough variation (did the boiler switch at all?)")
+		}
+		matrix[col], matrix[pivot] = matrix[pivot], matrix[col]
+		for row := 0; row < size; row++ {
+			if row == col {
+				continue
+			}
+			factor := matrix[row][col] / matrix[col][col]
+			for j := col; j <= size; j++ {
+				matrix[row][j] -= factor * matrix[col][j]
+			}
+		}
+	}
+
+	solution := make([]float64, size)
+	for i := range solution {
+		solution[i] = matrix[i][size] / matrix[i][i]
+	}
+	return solution, nil
+}
+
+func minTime(a time.Time, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func Key(boilerName string) string {
+	return "thermal:" + boilerName
+}
+
+func Save(ctx context.Context, client storage.KeyValue, boilerName string, m *Model) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return client.Set(ctx, Key(boilerName), data)
+}
+
+// Returns nil if no model was identified for the boiler yet
+func Load(ctx context.Context, client storage.KeyValue, boilerName string) (*Model, error) {
+	data, err := client.Get(ctx, Key(boilerName))
+	switch err {
+	case storage.Nil:
+		return nil, nil
+	case nil:
+		m := &Model{}
+		err = json.Unmarshal(data, m)
+		return m, err
+	default:
+		return nil, err
+	}
+}
@@ -0,0 +1,137 @@
+package thermal
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"stupid-caldaia/controller/graph/model"
+	"stupid-caldaia/controller/storage"
+)
+
+// Simulates a house with the given model, heated with a 19-21°C thermostat,
+// sampled every 5 minutes like the compacted sensor series
+func simulateHouse(lossRate float64, heatingRate float64, outdoor func(time.Time) float64) ([]*model.Measure, []*model.SwitchSample, []*model.Measure) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	temperature := 15.0
+	on := false
+	indoor := []*model.Measure{}
+	outdoorMeasures := []*model.Measure{}
+	switches := []*model.SwitchSample{{State: model.StateOff, Time: t0}}
+	for minute := 0; minute < 3*24*60; minute++ {
+		now := t0.Add(time.Duration(minute) * time.Minute)
+		if minute%5 == 0 {
+			indoor = append(indoor, &model.Measure{Value: temperature, Time: now})
+			outdoorMeasures = append(outdoorMeasures, &model.Measure{Value: outdoor(now), Time: now})
+		}
+		if !on && temperature < 19 || on && temperature > 21 {
+			on = !on
+			state := model.StateOff
+			if on {
+				state = model.StateOn
+			}
+			switches = append(switches, &model.SwitchSample{State: state, Time: now})
+		}
+		u := 0.0
+		if on {
+			u = 1
+		}
+		temperature += (-lossRate*(temperature-outdoor(now)) + heatingRate*u) / 60
+	}
+	return indoor, switches, outdoorMeasures
+}
+
+func TestFit(t *testing.T) {
+	constant := func(time.Time) float64 { return 5 }
+	indoor, switches, _ := simulateHouse(0.1, 3, constant)
+	m, err := Fit(indoor, switches, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(m.LossRate-0.1) > 0.005 || math.Abs(m.HeatingRate-3) > 0.15 {
+		t.Fatalf("Expected loss rate 0.1 and heating rate 3 but got %.4f and %.4f", m.LossRate, m.HeatingRate)
+	}
+	if outdoor := m.Offset / m.LossRate; math.Abs(outdoor-5) > 0.5 {
+		t.Fatalf("Expected equivalent outdoor temperature of 5°C but got %.1f", outdoor)
+	}
+	if m.TimeConstant().Round(time.Hour) != 10*time.Hour {
+		t.Fatalf("Expected a 10h time constant but got %s", m.TimeConstant())
+	}
+	if m.Quality.R2 < 0.95 || m.Quality.RMSE > 0.2 {
+		t.Fatalf("Expected a good fit but got R² %.3f and RMSE %.2f", m.Quality.R2, m.Quality.RMSE)
+	}
+}
+
+func TestFitWithOutdoor(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	daily := func(now time.Time) float64 { return 5 + 5*math.Sin(2*math.Pi*now.Sub(t0).Hours()/24) }
+	indoor, switches, outdoor := simulateHouse(0.1, 3, daily)
+	m, err := Fit(indoor, switches, outdoor, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(m.LossRate-0.1) > 0.005 || math.Abs(m.HeatingRate-3) > 0.15 || math.Abs(m.Offset) > 0.05 {
+		t.Fatalf("Expected loss rate 0.1, heating rate 3 and no offset but got %.4f, %.4f and %.4f", m.LossRate, m.HeatingRate, m.Offset)
+	}
+	// 24kW heating 3°C per hour is 8kWh/°C, losing 10% of that per hour
+	if math.Abs(m.HeatCapacity-8) > 0.5 || math.Abs(m.HeatLossCoefficient-0.8) > 0.05 {
+		t.Fatalf("Expected 8kWh/°C and 0.8kW/°C but got %.2f and %.3f", m.HeatCapacity, m.HeatLossCoefficient)
+	}
+}
+
+func TestFitWithoutHeating(t *testing.T) {
+	indoor := []*model.Measure{}
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		indoor = append(indoor, &model.Measure{Value: 15 - 0.01*float64(i), Time: t0.Add(time.Duration(i) * 5 * time.Minute)})
+	}
+	_, err := Fit(indoor, []*model.SwitchSample{{State: model.StateOff, Time: t0}}, nil, 0)
+	if err == nil {
+		t.Fatal("Expected an error when the boiler never switched on")
+	}
+}
+
+func TestOnShare(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	switches := []*model.SwitchSample{
+		{State: model.StateOff, Time: t0},
+		{State: model.StateOn, Time: t0.Add(2 * time.Minute)},
+		{State: model.StateOff, Time: t0.Add(6 * time.Minute)},
+	}
+	testCases := []struct {
+		from time.Duration
+		to   time.Duration
+		want float64
+	}{
+		{0, 5 * time.Minute, 0.6},
+		{5 * time.Minute, 10 * time.Minute, 0.2},
+		{3 * time.Minute, 4 * time.Minute, 1},
+		{10 * time.Minute, 15 * time.Minute, 0},
+	}
+	for _, tc := range testCases {
+		got := onShare(switches, t0.Add(tc.from), t0.Add(tc.to))
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Fatalf("From %s to %s: wanted %.2f but got %.2f", tc.from, tc.to, tc.want, got)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	ctx := context.Background()
+	client := storage.NewMemory()
+	m, err := Load(ctx, client, "boiler")
+	if err != nil || m != nil {
+		t.Fatalf("Expected no model yet but got %v, %v", m, err)
+	}
+	if err := Save(ctx, client, "boiler", &Model{LossRate: 0.1, HeatingRate: 3}); err != nil {
+		t.Fatal(err)
+	}
+	m, err = Load(ctx, client, "boiler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.LossRate != 0.1 || m.HeatingRate != 3 {
+		t.Fatalf("Unexpected model loaded: %+v", m)
+	}
+}
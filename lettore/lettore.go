@@ -26,17 +26,22 @@ var (
 	wg          sync.WaitGroup
 )
 
-func ObserveState(ctx context.Context, boiler *model.Boiler) {
-	err := rpio.Open()
-	if err != nil {
-		log.Panic("Could not open gpio... 😱")
-	}
+// The relay of a zone follows the boiler state only while the controller is
+// alive, otherwise it is kept off
+type relay struct {
+	mu               sync.Mutex
+	boiler           *model.Boiler
+	state            model.State
+	controllerOnline bool
+}
 
-	updateIO := func(info *model.BoilerInfo) {
-		pin := rpio.Pin(boiler.Config.SwitchPin)
-		pin.Output()
-		fmt.Printf("State has changed 😮, updating gpio 👉 %d to %s\n", boiler.Config.SwitchPin, info.State)
-		switch info.State {
+func (r *relay) apply() {
+	pin := rpio.Pin(r.boiler.Config.SwitchPin)
+	pin.Output()
+	if !r.controllerOnline {
+		pin.Low()
+	} else {
+		switch r.state {
 		case model.StateOn:
 			pin.High()
 		case model.StateOff:
@@ -45,13 +50,85 @@ func ObserveState(ctx context.Context, boiler *model.Boiler) {
 			break
 		}
 	}
+	r.ack()
+}
+
+// Tells the controller what the pin is actually doing
+func (r *relay) ack() {
+	actual := model.StateOff
+	if rpio.Pin(r.boiler.Config.SwitchPin).Read() == rpio.High {
+		actual = model.StateOn
+	}
+	err := r.boiler.AckRelay(context.Background(), actual, time.Now())
+	if err != nil {
+		fmt.Println(fmt.Errorf("could not acknowledge relay state: %w", err))
+	}
+}
+
+func (r *relay) reAck() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ack()
+}
+
+func (r *relay) setState(state model.State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if state == r.state {
+		return
+	}
+	fmt.Printf("State of %s has changed 😮, updating gpio 👉 %d to %s\n", r.boiler.Config.Name, r.boiler.Config.SwitchPin, state)
+	r.state = state
+	r.apply()
+}
+
+func (r *relay) setControllerOnline(online bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if online {
+		fmt.Printf("Controller of %s is back 💚, relay follows its state again\n", r.boiler.Config.Name)
+	} else {
+		fmt.Printf("Controller of %s is gone 💔, keeping gpio 👉 %d OFF\n", r.boiler.Config.Name, r.boiler.Config.SwitchPin)
+	}
+	r.controllerOnline = online
+	r.apply()
+}
+
+func ObserveState(ctx context.Context, boiler *model.Boiler) {
+	r := &relay{boiler: boiler, controllerOnline: true}
 
 	// Make sure we set I/O right from the start according to our state.
 	onStartInfo, err := boiler.GetInfo(ctx)
 	if err != nil {
 		log.Panic("Could not get intial boiler state 😱")
 	}
-	updateIO(onStartInfo)
+	r.setState(onStartInfo.State)
+
+	// Tell the controller we are alive, and what the relay is doing
+	go func() {
+		ticker := time.NewTicker(model.HEARTBEAT_PERIOD)
+		defer ticker.Stop()
+		for {
+			err := boiler.SendHeartbeat(ctx, model.WorkerHeartbeat, time.Now())
+			if err != nil {
+				fmt.Println(fmt.Errorf("could not send heartbeat: %w", err))
+			}
+			r.reAck()
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// And make sure it is too
+	go func() {
+		err := boiler.WatchHeartbeats(ctx, model.ControllerHeartbeat, model.HEARTBEAT_TIMEOUT, r.setControllerOnline)
+		if err != nil {
+			log.Panic(err)
+		}
+	}()
 
 	listener, err := boiler.Listen(ctx)
 	if err != nil {
@@ -62,7 +139,7 @@ func ObserveState(ctx context.Context, boiler *model.Boiler) {
 		case <-ctx.Done():
 			return
 		default:
-			updateIO(info)
+			r.setState(info.State)
 		}
 	}
 }
@@ -118,24 +195,33 @@ func main() {
 		log.Panic(err)
 	}
 
-	wg.Add(2)
-	_, sensors, boiler := config.CreateObjects(ctx)
+	_, sensors, boilers := config.CreateObjects(ctx)
+	err = rpio.Open()
+	if err != nil {
+		log.Panic("Could not open gpio... 😱")
+	}
 
 	// Start go routines
+	wg.Add(1 + len(boilers))
 	go func() {
 		defer wg.Done()
 		ObserveSensor(ctx, sensors)
 	}()
 
-	go func() {
-		defer wg.Done()
-		ObserveState(ctx, boiler)
-	}()
+	// One relay per zone
+	for _, boiler := range boilers {
+		go func() {
+			defer wg.Done()
+			ObserveState(ctx, boiler)
+		}()
+	}
 
 	defer func() {
-		pin := rpio.Pin(boiler.Config.SwitchPin)
-		pin.Output()
-		pin.Low()
+		for _, boiler := range boilers {
+			pin := rpio.Pin(boiler.Config.SwitchPin)
+			pin.Output()
+			pin.Low()
+		}
 		rpio.Close()
 	}()
 
@@ -70,10 +70,51 @@ func main() {
 		log.Panic(err)
 	}
 
-	_, sensors, boiler := config.CreateObjects(ctx)
-	boilerListener, err := boiler.Listen(ctx)
-	if err != nil {
-		log.Panic(err)
+	_, sensors, boilers := config.CreateObjects(ctx)
+	boilerListener := make(chan *model.BoilerInfo)
+	boilersByName := make(map[string]*model.Boiler)
+	for _, boiler := range boilers {
+		boilersByName[boiler.Config.Name] = boiler
+		listener, err := boiler.Listen(ctx)
+		if err != nil {
+			log.Panic(err)
+		}
+		go func() {
+			for info := range listener {
+				boilerListener <- info
+			}
+		}()
+	}
+
+	// Same heartbeats as the real worker
+	for _, boiler := range boilers {
+		go func() {
+			ticker := time.NewTicker(model.HEARTBEAT_PERIOD)
+			defer ticker.Stop()
+			for {
+				err := boiler.SendHeartbeat(ctx, model.WorkerHeartbeat, time.Now())
+				if err != nil {
+					fmt.Println(fmt.Errorf("could not send heartbeat: %w", err))
+				}
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		go func() {
+			err := boiler.WatchHeartbeats(ctx, model.ControllerHeartbeat, model.HEARTBEAT_TIMEOUT, func(online bool) {
+				if online {
+					fmt.Printf("🤫 Controller of %s is online\n", boiler.Config.Name)
+				} else {
+					fmt.Printf("🤫 Controller of %s is gone, %s would be kept OFF\n", boiler.Config.Name, boiler.Config.Name)
+				}
+			})
+			if err != nil {
+				fmt.Println(fmt.Errorf("could not watch controller heartbeats: %w", err))
+			}
+		}()
 	}
 
 	fmt.Println("🤫 Mock worker started. Prepopulating data...")
@@ -92,9 +133,13 @@ func main() {
 		case boilerInfo := <-boilerListener:
 			switch boilerInfo.State {
 			case model.StateOff:
-				fmt.Println("🤫 Switching boiler OFF")
+				fmt.Printf("🤫 Switching %s OFF\n", boilerInfo.Name)
 			case model.StateOn:
-				fmt.Println("🤫 Switching boiler ON")
+				fmt.Printf("🤫 Switching %s ON\n", boilerInfo.Name)
+			}
+			// The mock relay always does what it is told
+			if boiler, ok := boilersByName[boilerInfo.Name]; ok && boilerInfo.State != boilerInfo.ActualState {
+				boiler.AckRelay(ctx, boilerInfo.State, time.Now())
 			}
 		case <-timeout:
 			timeout = time.After(10 * time.Second)